@@ -17,14 +17,33 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"github.com/fate-lovely/phi"
+	"github.com/streetbyters/agente/cmn"
 	"github.com/streetbyters/agente/database"
 	model2 "github.com/streetbyters/agente/database/model"
 	"github.com/streetbyters/agente/model"
 	"github.com/valyala/fasthttp"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
+var (
+	// errBlobNotExist blob with the given checksum is not stored
+	errBlobNotExist = errors.New("blob does not exist")
+	// errRangeNotSatisfiable byte range is out of the content
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// FileTokenExpire expire duration of file tokens sent to nodes with file
+// distribution messages
+var FileTokenExpire = time.Hour
+
 // FileController job files api controller
 type FileController struct {
 	Controller
@@ -82,9 +101,30 @@ func (c FileController) Create(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	// TODO: file distribute all worker nodes
+	if errs := c.confine(file); errs != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
 
-	var err error
+	err := c.blob(file)
+	if err == errBlobNotExist {
+		errs := make(map[string]string)
+		errs["checksum"] = "blob does not exist"
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
 
 	db := c.App.Database.Transaction(func(tx *database.Tx) error {
 		if err := c.App.Database.Insert(new(model2.File), file, "id", "inserted_at", "updated_at"); err != nil {
@@ -116,6 +156,25 @@ func (c FileController) Create(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	if err := c.link(file); err != nil {
+		c.App.Logger.LogError(err, "file blob could not be linked: "+file.Path())
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if err := cmn.PromoteUploads(c.App, file.Path(), file.Checksum.String); err != nil {
+		c.App.Logger.LogError(err, "uploads could not be promoted: "+file.Path())
+	}
+
+	if distribute, _ := strconv.ParseBool(c.ParseQuery(ctx)["distribute"]); distribute {
+		if _, err := c.distribute(file, model.MessageTargets{}); err != nil {
+			c.App.Logger.LogError(err, "file could not be distributed: "+file.Path())
+		}
+	}
+
 	c.JSONResponse(ctx, model.ResponseSuccessOne{
 		Data: file,
 	}, fasthttp.StatusCreated)
@@ -142,35 +201,69 @@ func (c FileController) Update(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	var err error
+	if errs := c.confine(fileRequest); errs != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
 
-	db := c.App.Database.Transaction(func(tx *database.Tx) error {
-		if err := c.App.Database.Update(&file, fileRequest, nil, "id", "updated_at"); err != nil {
-			return err
-		}
+	if err := c.blob(fileRequest); err == errBlobNotExist {
+		errs := make(map[string]string)
+		errs["checksum"] = "blob does not exist"
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
 
-		log := model2.NewFileLog(file.ID)
-		log.NodeID = fileRequest.NodeID
-		log.Type = model.Update
-		log.Data = model2.FileLogData{
-			Dir:  file.Dir,
-			File: file.File,
-			Type: file.Type,
+	tx, err := c.App.Database.Begin()
+	if err == nil {
+		err = c.update(tx, &file, fileRequest)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else if tx != nil {
+		tx.Rollback()
+	}
+	if err != nil {
+		if errs, _ := database.ValidateConstraint(err, fileRequest); len(errs) > 0 {
+			c.JSONResponse(ctx, model.ResponseError{
+				Errors: errs,
+				Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+			}, fasthttp.StatusUnprocessableEntity)
+			return
 		}
 
-		c.App.Database.Insert(new(model2.FileLog), log, "id")
-		return nil
-	})
-	err = db.Error
+		c.App.Logger.LogError(err, "file could not be updated: "+file.Path())
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusInternalServerError),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
 
-	if errs, err := database.ValidateConstraint(err, fileRequest); err != nil {
+	if err := c.link(fileRequest); err != nil {
+		c.App.Logger.LogError(err, "file blob could not be linked: "+fileRequest.Path())
 		c.JSONResponse(ctx, model.ResponseError{
-			Errors: errs,
-			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
-		}, fasthttp.StatusUnprocessableEntity)
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
 		return
 	}
 
+	if err := cmn.PromoteUploads(c.App, fileRequest.Path(), file.Checksum.String); err != nil {
+		c.App.Logger.LogError(err, "uploads could not be promoted: "+fileRequest.Path())
+	}
+
 	c.JSONResponse(ctx, model.ResponseSuccessOne{
 		Data: nil,
 	}, fasthttp.StatusOK)
@@ -185,3 +278,387 @@ func (c FileController) Delete(ctx *fasthttp.RequestCtx) {
 		Data: nil,
 	}, fasthttp.StatusNoContent)
 }
+
+// update lock the job file row in the transaction, record version of its
+// current state and update it with the log. Version number is taken while
+// the row is locked, so concurrent updates record distinct versions.
+func (c FileController) update(tx *database.Database, file *model2.File, fileRequest *model2.File) error {
+	err := tx.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1 FOR UPDATE", file.TableName()),
+		file,
+		file.ID).Error
+	if err != nil {
+		return err
+	}
+
+	version, err := c.snapshot(file)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Update(file, fileRequest, nil, "id", "updated_at"); err != nil {
+		return err
+	}
+
+	log := model2.NewFileLog(file.ID)
+	log.NodeID = fileRequest.NodeID
+	log.Type = model.Update
+	log.Data = model2.FileLogData{
+		Dir:      file.Dir,
+		File:     file.File,
+		Type:     file.Type,
+		Checksum: file.Checksum.String,
+	}
+	if err := tx.Insert(new(model2.FileLog), log, "id"); err != nil {
+		return err
+	}
+
+	return cmn.AddFileVersion(tx, version)
+}
+
+// confine resolve dir of job file in lib path or allowed roots
+func (c FileController) confine(file *model2.File) map[string]string {
+	path, err := cmn.ResolvePath(c.App, file.Dir, file.File)
+	if err != nil {
+		errs := make(map[string]string)
+		errs["dir"] = "is not allowed"
+		return errs
+	}
+	file.Dir = filepath.Dir(path)
+
+	return nil
+}
+
+// snapshot version of current state of job file. Current content is stored
+// as a blob first, so the version is kept when the file is overwritten.
+func (c FileController) snapshot(file *model2.File) (*model2.FileVersion, error) {
+	blob, err := cmn.FileBlob(c.App, file)
+	if err != nil {
+		return nil, err
+	}
+
+	version := model2.NewFileVersion(file)
+	version.SourceUserID.SetValid(c.Auth.ID)
+	if blob != nil {
+		version.Checksum.SetValid(blob.Checksum)
+		version.Size.SetValid(blob.Size)
+		version.Mime.SetValid(blob.Mime)
+	}
+
+	return version, nil
+}
+
+// blob map job file onto its blob and record checksum, size and mime type
+// of the blob. Blob with the given checksum is opened, otherwise existing
+// content of the file path is stored as a blob.
+func (c FileController) blob(file *model2.File) error {
+	var blob *cmn.Blob
+	var err error
+
+	if file.Checksum.String != "" {
+		if blob, err = cmn.OpenBlob(c.App, file.Checksum.String, file.File); err != nil {
+			return errBlobNotExist
+		}
+	} else {
+		f, err := os.Open(file.Path())
+		if err != nil {
+			return nil
+		}
+		blob, err = cmn.StoreBlob(c.App, f, file.File)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	file.Checksum.SetValid(blob.Checksum)
+	file.Size.SetValid(blob.Size)
+	file.Mime.SetValid(blob.Mime)
+
+	return nil
+}
+
+// link copy blob of job file to the file path
+func (c FileController) link(file *model2.File) error {
+	if file.Checksum.String == "" {
+		return nil
+	}
+
+	return cmn.LinkBlob(c.App, file.Checksum.String, file.Path())
+}
+
+// Content stream content of job file. Nodes fetch distributed files with
+// file tokens from this endpoint. Content is streamed from the blob of the
+// file checksum, which is its ETag, so clients skip unchanged content with
+// If-None-Match and resume interrupted downloads with a single byte Range.
+// Files registered without a checksum are streamed from their path.
+func (c FileController) Content(ctx *fasthttp.RequestCtx) {
+	file := model2.NewFile()
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", file.TableName()),
+		file,
+		phi.URLParam(ctx, "fileID")).Force()
+
+	if _, err := cmn.ResolvePath(c.App, file.Dir, file.File); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusForbidden),
+		}, fasthttp.StatusForbidden)
+		return
+	}
+
+	path, checksum := file.Path(), ""
+	if file.Checksum.Valid && cmn.BlobExists(c.App, file.Checksum.String) {
+		path, checksum = cmn.BlobPath(c.App, file.Checksum.String), file.Checksum.String
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusNotFound),
+		}, fasthttp.StatusNotFound)
+		return
+	}
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusNotFound),
+		}, fasthttp.StatusNotFound)
+		return
+	}
+
+	etag := fileETag(checksum, info)
+	if etagMatch(string(ctx.Request.Header.Peek("If-None-Match")), etag, false) {
+		f.Close()
+		ctx.NotModified()
+		ctx.Response.Header.Set("ETag", etag)
+		return
+	}
+
+	ctx.Response.Header.Set("ETag", etag)
+	ctx.Response.Header.Set("Accept-Ranges", "bytes")
+	ctx.Response.Header.SetLastModified(info.ModTime())
+
+	size := info.Size()
+	byteRange := string(ctx.Request.Header.Peek("Range"))
+	if ifRange := string(ctx.Request.Header.Peek("If-Range")); ifRange != "" && !etagMatch(ifRange, etag, true) {
+		byteRange = ""
+	}
+	start, end, err := contentRange(byteRange, size)
+	if err != nil {
+		f.Close()
+		ctx.Response.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusRequestedRangeNotSatisfiable),
+		}, fasthttp.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	ctx.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.File))
+	if file.Mime.Valid && file.Mime.String != "" {
+		ctx.SetContentType(file.Mime.String)
+	} else {
+		ctx.SetContentType("application/octet-stream")
+	}
+
+	if start == 0 && end == size-1 {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBodyStream(f, int(size))
+		return
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.SetContentRange(int(start), int(end), int(size))
+	ctx.SetStatusCode(fasthttp.StatusPartialContent)
+	ctx.SetBodyStream(fileRange{Reader: io.LimitReader(f, end-start+1), Closer: f}, int(end-start+1))
+}
+
+// Distribute push job file to every worker node or to target nodes given in
+// request body. Target nodes fetch the file content from this node, verify
+// its checksum and register it as a child file.
+func (c FileController) Distribute(ctx *fasthttp.RequestCtx) {
+	file := model2.NewFile()
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", file.TableName()),
+		file,
+		phi.URLParam(ctx, "fileID")).Force()
+
+	errs := make(map[string]string)
+	if file.ParentID.Valid {
+		errs["file"] = "distributed file can not be distributed"
+	} else if _, err := cmn.ResolvePath(c.App, file.Dir, file.File); err != nil {
+		errs["file"] = "is not allowed"
+	} else if info, err := os.Stat(file.Path()); err != nil || info.IsDir() {
+		errs["file"] = "does not exist"
+	}
+
+	var targets model.MessageTargets
+	c.JSONBody(ctx, &targets)
+
+	for _, typ := range targets.NodeTypes {
+		if typ != model.Worker && typ != model.Master {
+			errs["node_types"] = "is not valid"
+		}
+	}
+
+	if len(errs) > 0 {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	message, err := c.distribute(file, targets)
+	if err != nil {
+		c.App.Logger.LogError(err, "file could not be distributed: "+file.Path())
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable),
+		}, fasthttp.StatusServiceUnavailable)
+		return
+	}
+
+	distribution := *message.Distribution
+	distribution.Token = ""
+	message.Distribution = &distribution
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: message,
+	}, fasthttp.StatusAccepted)
+}
+
+// distribute publish distribution message of the file with its current
+// checksum and a file token
+func (c FileController) distribute(file *model2.File, targets model.MessageTargets) (*model.ReceivedMessage, error) {
+	checksum, size, err := cmn.FileChecksum(file.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Checksum.String != checksum {
+		file.Checksum.SetValid(checksum)
+		_, err = c.App.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET checksum = $1 WHERE id = $2",
+			file.TableName()), file.Checksum, file.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := c.JWTAuth.GenerateFile(file.ID, FileTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+
+	message := model.NewDistributionMessage(&model.FileDistribution{
+		FileID:   file.ID,
+		URL:      fmt.Sprintf("%s/api/v1/file/%d/content", cmn.NodeURL(c.App), file.ID),
+		Token:    token,
+		Checksum: checksum,
+		Size:     size,
+	}, targets)
+
+	return message, c.App.Queue.Publish(message)
+}
+
+// fileRange reader of a byte range of an open file closing the file once
+// the range is streamed
+type fileRange struct {
+	io.Reader
+	io.Closer
+}
+
+// fileETag strong ETag of checksum of the streamed blob. Files streamed
+// without a blob have a weak ETag of their size and modification time.
+func fileETag(checksum string, info os.FileInfo) string {
+	if checksum != "" {
+		return strconv.Quote(checksum)
+	}
+
+	return fmt.Sprintf("W/\"%x-%x\"", info.Size(), info.ModTime().UnixNano())
+}
+
+// etagMatch check whether the comma separated ETag list of a conditional
+// request header matches the etag. Weak ETags never match strongly.
+func etagMatch(header string, etag string, strong bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if tag == "*" && !strong {
+			return true
+		}
+		if strong {
+			if tag == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentRange first and last byte positions of a single byte range of
+// Range header. Whole content is served for an empty, malformed or multiple
+// byte range header.
+func contentRange(header string, size int64) (int64, int64, error) {
+	spec := strings.TrimSpace(header)
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return 0, size - 1, nil
+	}
+
+	spec = strings.TrimSpace(strings.TrimPrefix(spec, "bytes="))
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, size - 1, nil
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, size - 1, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size - 1, nil
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, size - 1, nil
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+
+	return start, end, nil
+}
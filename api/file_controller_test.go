@@ -1,9 +1,17 @@
 package api
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/streetbyters/agente/cmn"
 	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
 	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -144,6 +152,103 @@ func (s FileControllerTest) Test_CreateFileWithValidParamsAndNodeParams() {
 	defaultLogger.LogInfo("Create a file with valid params and node param")
 }
 
+func (s FileControllerTest) Test_CreateFileWithBlobChecksum() {
+	blob, err := cmn.StoreBlob(s.API.App, bytes.NewBufferString("#!/bin/sh"), "deploy.sh")
+	s.Nil(err)
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	file := model.NewFile()
+	file.Dir = dir
+	file.File = "deploy.sh"
+	file.Checksum.SetValid(blob.Checksum)
+
+	response := s.JSON(Post, "/api/v1/file", file)
+
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+	s.Equal(data["checksum"], blob.Checksum)
+	s.Equal(data["size"], float64(9))
+	s.Equal(data["mime"], blob.Mime)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "deploy.sh"))
+	s.Nil(err)
+	s.Equal(string(content), "#!/bin/sh")
+
+	file.File = "unknown.sh"
+	file.Checksum.SetValid("unknown")
+	response = s.JSON(Post, "/api/v1/file", file)
+
+	s.Equal(response.Status, fasthttp.StatusUnprocessableEntity)
+
+	file.File = "failed.sh"
+	file.Checksum.SetValid(blob.Checksum)
+	file.JobID.SetValid(999999999)
+	response = s.JSON(Post, "/api/v1/file", file)
+
+	s.NotEqual(response.Status, fasthttp.StatusCreated)
+	_, err = os.Stat(filepath.Join(dir, "failed.sh"))
+	s.True(os.IsNotExist(err))
+
+	defaultLogger.LogInfo("Create a file with blob checksum")
+}
+
+func (s FileControllerTest) Test_CreateFileRecordsExistingContent() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+	s.Nil(ioutil.WriteFile(filepath.Join(dir, "app.json"), []byte("{}"), 0644))
+
+	file := model.NewFile()
+	file.Dir = dir
+	file.File = "app.json"
+
+	response := s.JSON(Post, "/api/v1/file", file)
+
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+	s.Len(data["checksum"], 64)
+	s.Equal(data["size"], float64(2))
+	s.Equal(data["mime"], "application/json")
+	s.True(cmn.BlobExists(s.API.App, data["checksum"].(string)))
+
+	defaultLogger.LogInfo("Create a file records existing content")
+}
+
+func (s FileControllerTest) Test_Should_422Err_CreateFileIfPathIsNotAllowed() {
+	for _, path := range [][2]string{
+		{"/etc", "passwd"},
+		{"../../etc", "passwd"},
+		{"/tmp/../etc", "passwd"},
+		{"/tmp", "../etc/passwd"},
+	} {
+		file := model.NewFile()
+		file.Dir = path[0]
+		file.File = path[1]
+
+		response := s.JSON(Post, "/api/v1/file", file)
+
+		s.Equal(response.Status, fasthttp.StatusUnprocessableEntity, path)
+		s.Equal(response.Error.Errors.(map[string]interface{})["dir"], "is not allowed")
+	}
+
+	file := model.NewFile()
+	file.NodeID = s.API.App.Node.ID
+	file.Dir = "/tmp"
+	file.File = "file_update_not_allowed.go"
+	err := s.API.App.Database.Insert(new(model.File), file, "id", "inserted_at", "updated_at")
+	s.Nil(err)
+
+	fileRequest := model.NewFile()
+	fileRequest.Dir = "/root"
+	fileRequest.File = "file.go"
+	response := s.JSON(Put, fmt.Sprintf("/api/v1/file/%d", file.ID), fileRequest)
+
+	s.Equal(response.Status, fasthttp.StatusUnprocessableEntity)
+
+	defaultLogger.LogInfo("Should be 422 error create or update a file if path is not allowed")
+}
+
 func (s FileControllerTest) Test_Should_422Err_CreateFileWithInvalidParams() {
 	file := model.NewFile()
 	file.Dir = "/tmp"
@@ -237,6 +342,242 @@ func (s FileControllerTest) Test_Should_404Err_DeleteFileWithGivenIdentifierIfNo
 		"if does not exists")
 }
 
+func (s FileControllerTest) newFile(name string, content string) *model.File {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	s.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+
+	file := model.NewFile()
+	file.NodeID = s.API.App.Node.ID
+	file.Dir = dir
+	file.File = name
+	err = s.API.App.Database.Insert(new(model.File), file, "id", "inserted_at", "updated_at")
+	s.Nil(err)
+
+	return file
+}
+
+func (s FileControllerTest) content(file *model.File, token string, headers ...string) *fasthttp.Response {
+	req := fasthttp.AcquireRequest()
+	req.Header.SetHost(s.API.Router.Addr)
+	req.Header.SetRequestURI(fmt.Sprintf("/api/v1/file/%d/content", file.ID))
+	req.Header.SetMethod(string(Get))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp := fasthttp.AcquireResponse()
+	s.Nil(s.serveAPI(s.API.Router.Handler.ServeFastHTTP, req, resp))
+
+	return resp
+}
+
+func (s FileControllerTest) Test_DistributeFile() {
+	file := s.newFile("release.tar.gz", "release")
+	defer os.RemoveAll(file.Dir)
+
+	response := s.JSON(Post, fmt.Sprintf("/api/v1/file/%d/distribute", file.ID),
+		map[string]interface{}{"nodes": []string{"node_worker@distributed"}})
+
+	s.Equal(response.Status, fasthttp.StatusAccepted)
+	data, _ := response.Success.Data.(map[string]interface{})
+	s.Equal(data["nodes"], []interface{}{"node_worker@distributed"})
+	distribution, _ := data["distribution"].(map[string]interface{})
+	s.Equal(distribution["file_id"], float64(file.ID))
+	s.Equal(distribution["size"], float64(7))
+	s.Len(distribution["checksum"], 64)
+	s.Nil(distribution["token"])
+
+	var checksum string
+	err := s.API.App.Database.DB.Get(&checksum, "SELECT checksum FROM ra_files WHERE id = $1", file.ID)
+	s.Nil(err)
+	s.Equal(checksum, distribution["checksum"])
+
+	defaultLogger.LogInfo("Distribute a file")
+}
+
+func (s FileControllerTest) Test_Should_422Err_DistributeFileIfNotExistsOnDisk() {
+	file := model.NewFile()
+	file.NodeID = s.API.App.Node.ID
+	file.Dir = "/tmp"
+	file.File = "file_distribute_not_exists.go"
+	err := s.API.App.Database.Insert(new(model.File), file, "id", "inserted_at", "updated_at")
+	s.Nil(err)
+
+	response := s.JSON(Post, fmt.Sprintf("/api/v1/file/%d/distribute", file.ID), nil)
+
+	s.Equal(response.Status, fasthttp.StatusUnprocessableEntity)
+
+	defaultLogger.LogInfo("Should be 422 error distribute a file if does not exists on disk")
+}
+
+func (s FileControllerTest) Test_GetFileContentWithFileToken() {
+	file := s.newFile("content.tar.gz", "content")
+	defer os.RemoveAll(file.Dir)
+	other := s.newFile("other.tar.gz", "other")
+	defer os.RemoveAll(other.Dir)
+
+	token, err := s.API.JWTAuth.GenerateFile(file.ID, time.Minute)
+	s.Nil(err)
+
+	resp := s.content(file, token)
+	s.Equal(resp.StatusCode(), fasthttp.StatusOK)
+	s.Equal(string(resp.Body()), "content")
+
+	resp = s.content(other, token)
+	s.Equal(resp.StatusCode(), fasthttp.StatusForbidden)
+
+	resp = s.content(file, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusForbidden)
+
+	resp = s.content(file, s.Auth.Token)
+	s.Equal(resp.StatusCode(), fasthttp.StatusOK)
+
+	response := s.JSON(Get, "/api/v1/file", nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+	auth := s.Auth.Token
+	s.Auth.Token = token
+	response = s.JSON(Get, "/api/v1/file", nil)
+	s.Auth.Token = auth
+	s.Equal(response.Status, fasthttp.StatusForbidden)
+
+	defaultLogger.LogInfo("Get file content with file token")
+}
+
+func (s FileControllerTest) Test_GetFileContentWithRange() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+	s.Nil(ioutil.WriteFile(filepath.Join(dir, "agente.txt"), []byte("agente content"), 0644))
+
+	response := s.JSON(Post, "/api/v1/file", map[string]interface{}{"dir": dir, "file": "agente.txt"})
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+	file := model.NewFile()
+	file.ID = int64(data["id"].(float64))
+	etag := strconv.Quote(data["checksum"].(string))
+
+	resp := s.content(file, s.Auth.Token)
+	s.Equal(resp.StatusCode(), fasthttp.StatusOK)
+	s.Equal(string(resp.Body()), "agente content")
+	s.Equal(resp.Header.ContentLength(), 14)
+	s.Equal(string(resp.Header.Peek("ETag")), etag)
+	s.Equal(string(resp.Header.Peek("Accept-Ranges")), "bytes")
+	s.Equal(string(resp.Header.ContentType()), "text/plain; charset=utf-8")
+
+	resp = s.content(file, s.Auth.Token, "If-None-Match", etag)
+	s.Equal(resp.StatusCode(), fasthttp.StatusNotModified)
+	s.Empty(resp.Body())
+
+	resp = s.content(file, s.Auth.Token, "Range", "bytes=7-")
+	s.Equal(resp.StatusCode(), fasthttp.StatusPartialContent)
+	s.Equal(string(resp.Body()), "content")
+	s.Equal(string(resp.Header.Peek("Content-Range")), "bytes 7-13/14")
+
+	resp = s.content(file, s.Auth.Token, "Range", "bytes=-4")
+	s.Equal(resp.StatusCode(), fasthttp.StatusPartialContent)
+	s.Equal(string(resp.Body()), "tent")
+
+	resp = s.content(file, s.Auth.Token, "Range", "bytes=0-5", "If-Range", "\"changed\"")
+	s.Equal(resp.StatusCode(), fasthttp.StatusOK)
+	s.Equal(string(resp.Body()), "agente content")
+
+	resp = s.content(file, s.Auth.Token, "Range", "bytes=20-")
+	s.Equal(resp.StatusCode(), fasthttp.StatusRequestedRangeNotSatisfiable)
+	s.Equal(string(resp.Header.Peek("Content-Range")), "bytes */14")
+
+	defaultLogger.LogInfo("Get file content with range")
+}
+
+func (s FileControllerTest) Test_GetFileContentFromBlobIfPathIsChanged() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+	s.Nil(ioutil.WriteFile(filepath.Join(dir, "blob.txt"), []byte("blob content"), 0644))
+
+	response := s.JSON(Post, "/api/v1/file", map[string]interface{}{"dir": dir, "file": "blob.txt"})
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+	file := model.NewFile()
+	file.ID = int64(data["id"].(float64))
+
+	s.Nil(os.Remove(filepath.Join(dir, "blob.txt")))
+	s.Nil(ioutil.WriteFile(filepath.Join(dir, "blob.txt"), []byte("changed"), 0644))
+
+	resp := s.content(file, s.Auth.Token)
+	s.Equal(resp.StatusCode(), fasthttp.StatusOK)
+	s.Equal(string(resp.Body()), "blob content")
+	s.Equal(string(resp.Header.Peek("ETag")), strconv.Quote(data["checksum"].(string)))
+
+	defaultLogger.LogInfo("Get file content from blob if path is changed")
+}
+
+func (s FileControllerTest) Test_FetchDistributedFile() {
+	file := s.newFile("fetch.tar.gz", "fetch")
+	defer os.RemoveAll(file.Dir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Nil(err)
+	defer ln.Close()
+	go fasthttp.Serve(ln, s.API.Router.Handler.ServeFastHTTP)
+
+	node := model.NewNode()
+	node.Name = "node_worker@fetch"
+	node.Code = "node_worker@fetch"
+	node.Type = model2.Worker
+	err = s.API.App.Database.Insert(new(model.Node), node, "id")
+	s.Nil(err)
+
+	config := *s.API.App.Config
+	config.NodeType = model2.Worker
+	worker := &cmn.App{
+		Database: s.API.App.Database,
+		Config:   &config,
+		Logger:   s.API.App.Logger,
+		Node:     node,
+	}
+
+	checksum, size, err := cmn.FileChecksum(file.Path())
+	s.Nil(err)
+	token, err := s.API.JWTAuth.GenerateFile(file.ID, time.Minute)
+	s.Nil(err)
+	distribution := &model2.FileDistribution{
+		FileID:   file.ID,
+		URL:      fmt.Sprintf("http://%s/api/v1/file/%d/content", ln.Addr().String(), file.ID),
+		Token:    token,
+		Checksum: checksum,
+		Size:     size,
+	}
+
+	child, err := cmn.FetchFile(worker, distribution)
+	s.Nil(err)
+	s.Equal(child.ParentID.Int64, file.ID)
+	s.Equal(child.NodeID, node.ID)
+	s.Equal(child.Checksum.String, checksum)
+
+	_, err = cmn.FetchFile(worker, distribution)
+	s.Nil(err)
+
+	var count int64
+	err = s.API.App.Database.DB.Get(&count, "SELECT count(*) FROM ra_files WHERE parent_id = $1", file.ID)
+	s.Nil(err)
+	s.Equal(count, int64(1))
+
+	err = s.API.App.Database.DB.Get(&count, "SELECT count(*) FROM ra_file_logs "+
+		"WHERE file_id = $1 AND node_id = $2 AND type = $3", file.ID, node.ID, model2.Distributing)
+	s.Nil(err)
+	s.Equal(count, int64(2))
+
+	os.Remove(file.Path())
+	distribution.Checksum = "invalid"
+	_, err = cmn.FetchFile(worker, distribution)
+	s.NotNil(err)
+
+	defaultLogger.LogInfo("Fetch a distributed file")
+}
+
 func (s FileControllerTest) TearDownSuite() {
 	TearDownSuite(s.Suite)
 }
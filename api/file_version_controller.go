@@ -0,0 +1,246 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"github.com/fate-lovely/phi"
+	"github.com/streetbyters/agente/cmn"
+	"github.com/streetbyters/agente/database"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"strconv"
+)
+
+// FileVersionController file version api controller
+type FileVersionController struct {
+	Controller
+	*API
+}
+
+// Index list all versions of job file
+func (c FileVersionController) Index(ctx *fasthttp.RequestCtx) {
+	paginate, _, _ := c.Paginate(ctx, "id", "version", "inserted_at")
+
+	file := c.file(ctx)
+	version := new(model2.FileVersion)
+	versions := make([]model2.FileVersion, 0)
+	c.App.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s WHERE file_id = $1 "+
+		"ORDER BY %s %s LIMIT $2 OFFSET $3",
+		version.TableName(), paginate.OrderField, paginate.OrderBy),
+		&versions,
+		file.ID,
+		paginate.Limit,
+		paginate.Offset)
+
+	var count int64
+	c.App.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s WHERE file_id = $1",
+		version.TableName()), file.ID)
+
+	c.JSONResponse(ctx, model.ResponseSuccess{
+		Data:       versions,
+		TotalCount: count,
+	}, fasthttp.StatusOK)
+}
+
+// Show a version of job file
+func (c FileVersionController) Show(ctx *fasthttp.RequestCtx) {
+	version := c.version(ctx, c.file(ctx), phi.URLParam(ctx, "version"))
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: version,
+	}, fasthttp.StatusOK)
+}
+
+// Diff line diff of text content of a version of job file with the version
+// given in to query param or with current content of the file
+func (c FileVersionController) Diff(ctx *fasthttp.RequestCtx) {
+	file := c.file(ctx)
+	from := c.version(ctx, file, phi.URLParam(ctx, "version"))
+
+	errs := make(map[string]string)
+	diff := model2.FileVersionDiff{FileID: file.ID, From: from.Version}
+	toChecksum := file.Checksum.String
+	toName := file.Path()
+	if to := c.ParseQuery(ctx)["to"]; to != "" {
+		if _, err := strconv.ParseInt(to, 10, 64); err != nil {
+			errs["to"] = "is not valid"
+		} else {
+			version := c.version(ctx, file, to)
+			diff.To = &version.Version
+			toChecksum = version.Checksum.String
+			toName = version.Path()
+		}
+	} else if blob, err := cmn.FileBlob(c.App, file); err == nil && blob != nil {
+		toChecksum = blob.Checksum
+	}
+
+	var a, b string
+	var err error
+	if errs["to"] == "" {
+		if a, err = c.text(from.Checksum.String); err != nil {
+			errs["version"] = err.Error()
+		} else if b, err = c.text(toChecksum); err != nil {
+			errs["to"] = err.Error()
+		}
+	}
+
+	if len(errs) > 0 {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	diff.Diff, diff.Additions, diff.Deletions = cmn.UnifiedDiff(from.Path(), toName, a, b)
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: diff,
+	}, fasthttp.StatusOK)
+}
+
+// Restore job file to a version. Current state of the file is recorded as a
+// new version first, so restoring can be undone.
+func (c FileVersionController) Restore(ctx *fasthttp.RequestCtx) {
+	file := c.file(ctx)
+	version := c.version(ctx, file, phi.URLParam(ctx, "version"))
+
+	errs := make(map[string]string)
+	if _, err := cmn.ResolvePath(c.App, version.Dir, version.File); err != nil {
+		errs["dir"] = "is not allowed"
+	} else if version.Checksum.String != "" && !cmn.BlobExists(c.App, version.Checksum.String) {
+		errs["checksum"] = "blob does not exist"
+	}
+
+	if len(errs) > 0 {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	tx, err := c.App.Database.Begin()
+	if err == nil {
+		err = c.restore(tx, file, version)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else if tx != nil {
+		tx.Rollback()
+	}
+	if err == nil && version.Checksum.String != "" {
+		err = cmn.LinkBlob(c.App, version.Checksum.String, version.Path())
+	}
+	if err != nil {
+		c.App.Logger.LogError(err, "file could not be restored: "+version.Path())
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if err := cmn.PromoteUploads(c.App, file.Path(), file.Checksum.String); err != nil {
+		c.App.Logger.LogError(err, "uploads could not be promoted: "+file.Path())
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: file,
+	}, fasthttp.StatusOK)
+}
+
+// restore lock the job file row in the transaction, record version of its
+// current state and update it to the version with the log. Blob of the
+// version is linked to the file path after the transaction is committed.
+func (c FileVersionController) restore(tx *database.Database, file *model2.File, version *model2.FileVersion) error {
+	err := tx.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1 FOR UPDATE", file.TableName()),
+		file,
+		file.ID).Error
+	if err != nil {
+		return err
+	}
+
+	current, err := FileController{API: c.API}.snapshot(file)
+	if err != nil {
+		return err
+	}
+	if err := cmn.AddFileVersion(tx, current); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowWithModel(fmt.Sprintf("UPDATE %s SET dir = $1, file = $2, type = $3, "+
+		"checksum = $4, size = $5, mime = $6, updated_at = (CURRENT_TIMESTAMP at time zone 'utc') "+
+		"WHERE id = $7 RETURNING *", file.TableName()),
+		file,
+		version.Dir,
+		version.File,
+		version.Type,
+		version.Checksum,
+		version.Size,
+		version.Mime,
+		file.ID).Error
+	if err != nil {
+		return err
+	}
+
+	log := model2.NewFileLog(file.ID)
+	log.NodeID = file.NodeID
+	log.SourceUserID.SetValid(c.Auth.ID)
+	log.Type = model.Update
+	log.Data = model2.FileLogData{
+		Dir:      file.Dir,
+		File:     file.File,
+		Type:     file.Type,
+		Checksum: file.Checksum.String,
+	}
+
+	return tx.Insert(new(model2.FileLog), log, "id")
+}
+
+// file job file given in url
+func (c FileVersionController) file(ctx *fasthttp.RequestCtx) *model2.File {
+	file := model2.NewFile()
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", file.TableName()),
+		file,
+		phi.URLParam(ctx, "fileID")).Force()
+
+	return file
+}
+
+// version version of job file with given version number
+func (c FileVersionController) version(ctx *fasthttp.RequestCtx, file *model2.File, number string) *model2.FileVersion {
+	version := new(model2.FileVersion)
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE file_id = $1 AND version = $2",
+		version.TableName()),
+		version,
+		file.ID,
+		number).Force()
+
+	return version
+}
+
+// text utf-8 encoded text content of blob with given checksum
+func (c FileVersionController) text(checksum string) (string, error) {
+	if checksum == "" || !cmn.BlobExists(c.App, checksum) {
+		return "", errBlobNotExist
+	}
+
+	return cmn.ReadText(c.App, checksum)
+}
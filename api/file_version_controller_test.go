@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/streetbyters/agente/cmn"
+	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type FileVersionControllerTest struct {
+	*Suite
+}
+
+func (s FileVersionControllerTest) SetupSuite() {
+	SetupSuite(s.Suite)
+	UserAuth(s.Suite)
+}
+
+func (s FileVersionControllerTest) Test_ListDiffAndRestoreFileVersions() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	file := s.newFile(dir, "deploy.sh", "echo start\necho deploy\n")
+	old := file.Checksum.String
+	blob, err := cmn.StoreBlob(s.API.App, bytes.NewBufferString("echo start\necho release\n"), "deploy.sh")
+	s.Nil(err)
+
+	response := s.JSON(Put, fmt.Sprintf("/api/v1/file/%d", file.ID),
+		map[string]interface{}{"dir": dir, "file": "deploy.sh", "checksum": blob.Checksum})
+	s.Equal(response.Status, fasthttp.StatusOK)
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "deploy.sh"))
+	s.Equal(string(content), "echo start\necho release\n")
+
+	response = s.JSON(Get, fmt.Sprintf("/api/v1/file/%d/version", file.ID), nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+	s.Equal(response.Success.TotalCount, int64(1))
+	versions, _ := response.Success.Data.([]interface{})
+	version, _ := versions[0].(map[string]interface{})
+	s.Equal(version["version"], float64(1))
+	s.Equal(version["checksum"], old)
+
+	response = s.JSON(Get, fmt.Sprintf("/api/v1/file/%d/version/1/diff", file.ID), nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+	diff, _ := response.Success.Data.(map[string]interface{})
+	s.Equal(diff["additions"], float64(1))
+	s.Equal(diff["deletions"], float64(1))
+	s.Nil(diff["to"])
+	s.Contains(diff["diff"], " echo start\n-echo deploy\n+echo release\n")
+
+	response = s.JSON(Post, fmt.Sprintf("/api/v1/file/%d/version/1/restore", file.ID), nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+	data, _ := response.Success.Data.(map[string]interface{})
+	s.Equal(data["checksum"], old)
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "deploy.sh"))
+	s.Equal(string(content), "echo start\necho deploy\n")
+
+	response = s.JSON(Get, fmt.Sprintf("/api/v1/file/%d/version/2/diff?to=1", file.ID), nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+	diff, _ = response.Success.Data.(map[string]interface{})
+	s.Equal(diff["from"], float64(2))
+	s.Equal(diff["to"], float64(1))
+	s.Contains(diff["diff"], "-echo release\n+echo deploy\n")
+
+	var log model.FileLog
+	err = s.API.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s "+
+		"WHERE file_id = $1 ORDER BY id DESC LIMIT 1", log.TableName()), &log, file.ID).Error
+	s.Nil(err)
+	s.Equal(log.Type, model2.Update)
+	s.Equal(log.Data.Checksum, old)
+
+	defaultLogger.LogInfo("List, diff and restore file versions")
+}
+
+func (s FileVersionControllerTest) Test_Should_422Err_DiffFileVersionIfNotText() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	file := s.newFile(dir, "agente.bin", "\x00\x01\x02")
+	blob, err := cmn.StoreBlob(s.API.App, bytes.NewBufferString("\x00\x01\x03"), "agente.bin")
+	s.Nil(err)
+
+	response := s.JSON(Put, fmt.Sprintf("/api/v1/file/%d", file.ID),
+		map[string]interface{}{"dir": dir, "file": "agente.bin", "checksum": blob.Checksum})
+	s.Equal(response.Status, fasthttp.StatusOK)
+
+	response = s.JSON(Get, fmt.Sprintf("/api/v1/file/%d/version/1/diff", file.ID), nil)
+	s.Equal(response.Status, fasthttp.StatusUnprocessableEntity)
+	s.Equal(response.Error.Errors.(map[string]interface{})["version"], cmn.ErrNotText.Error())
+
+	response = s.JSON(Get, fmt.Sprintf("/api/v1/file/%d/version/2/diff", file.ID), nil)
+	s.Equal(response.Status, fasthttp.StatusNotFound)
+
+	defaultLogger.LogInfo("Should be 422 error diff file version if content is not text")
+}
+
+func (s FileVersionControllerTest) Test_RecordDistinctVersionsOfConcurrentUpdates() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	file := s.newFile(dir, "config.yml", "release: 0\n")
+
+	statuses := make([]int, 5)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		blob, err := cmn.StoreBlob(s.API.App, bytes.NewBufferString(fmt.Sprintf("release: %d\n", i+1)), "config.yml")
+		s.Nil(err)
+
+		wg.Add(1)
+		go func(i int, checksum string) {
+			defer wg.Done()
+			response := s.JSON(Put, fmt.Sprintf("/api/v1/file/%d", file.ID),
+				map[string]interface{}{"dir": dir, "file": "config.yml", "checksum": checksum})
+			statuses[i] = response.Status
+		}(i, blob.Checksum)
+	}
+	wg.Wait()
+
+	for _, status := range statuses {
+		s.Equal(status, fasthttp.StatusOK)
+	}
+
+	var versions []int64
+	err = s.API.App.Database.DB.Select(&versions, fmt.Sprintf("SELECT version FROM %s "+
+		"WHERE file_id = $1 ORDER BY version ASC", new(model.FileVersion).TableName()), file.ID)
+	s.Nil(err)
+	s.Equal(versions, []int64{1, 2, 3, 4, 5})
+
+	defaultLogger.LogInfo("Record distinct versions of concurrent file updates")
+}
+
+func (s FileVersionControllerTest) newFile(dir string, name string, content string) *model.File {
+	s.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+
+	response := s.JSON(Post, "/api/v1/file", map[string]interface{}{"dir": dir, "file": name})
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+
+	file := model.NewFile()
+	file.ID = int64(data["id"].(float64))
+	file.Checksum.SetValid(data["checksum"].(string))
+
+	return file
+}
+
+func (s FileVersionControllerTest) TearDownSuite() {
+	TearDownSuite(s.Suite)
+}
+
+func Test_FileVersionController(t *testing.T) {
+	s := FileVersionControllerTest{NewSuite()}
+	Run(t, s)
+}
@@ -19,7 +19,6 @@ package api
 import (
 	"github.com/streetbyters/agente/model"
 	"github.com/valyala/fasthttp"
-	"net/http"
 )
 
 // HomeController base controller
@@ -32,5 +31,26 @@ type HomeController struct {
 func (c HomeController) Index(ctx *fasthttp.RequestCtx) {
 	c.JSONResponse(ctx, model.ResponseSuccess{
 		Data: "Agente",
-	}, http.StatusOK)
+	}, fasthttp.StatusOK)
+}
+
+// Health node and queuing system connection status. Responds with service
+// unavailable if the queuing system is not connected.
+func (c HomeController) Health(ctx *fasthttp.RequestCtx) {
+	health := model.Health{
+		Node:    c.App.Config.NodeName,
+		Channel: c.App.Connection.Status(),
+	}
+	if c.App.Signer != nil {
+		health.RejectedMessages = c.App.Signer.Rejected()
+	}
+
+	status := fasthttp.StatusOK
+	if health.Channel.State != model.Connected {
+		status = fasthttp.StatusServiceUnavailable
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccess{
+		Data: health,
+	}, status)
 }
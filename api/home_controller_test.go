@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/streetbyters/agente/model"
 	"github.com/stretchr/testify/suite"
 	"testing"
 )
@@ -29,6 +30,21 @@ func (s *HomeControllerTest) Test_GetHomeWithAuthRequset() {
 	s.API.App.Logger.LogInfo("Success get home")
 }
 
+func (s *HomeControllerTest) Test_GetHealth() {
+	resp := s.JSON(Get, "/health", nil)
+
+	s.Equal(resp.Status, 200)
+	data, ok := resp.Success.Data.(map[string]interface{})
+	s.True(ok)
+	s.Equal(data["node"], s.API.App.Config.NodeName)
+	channel := data["channel"].(map[string]interface{})
+	s.Equal(channel["channel"], string(model.MemoryChannel))
+	s.Equal(channel["state"], string(model.Connected))
+	s.Equal(data["rejected_messages"], float64(0))
+
+	s.API.App.Logger.LogInfo("Success get health")
+}
+
 func (s *HomeControllerTest) Test_OptionsHome() {
 	resp := s.JSON(Options, "/", nil)
 
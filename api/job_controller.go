@@ -20,11 +20,21 @@ import (
 	"fmt"
 	"github.com/fate-lovely/phi"
 	"github.com/jmoiron/sqlx"
+	"github.com/streetbyters/agente/cmn"
 	model2 "github.com/streetbyters/agente/database/model"
 	"github.com/streetbyters/agente/model"
+	"github.com/streetbyters/agente/utils"
 	"github.com/valyala/fasthttp"
+	"strconv"
+	"time"
 )
 
+// DefaultScheduleCount number of fire times returned by schedule preview
+const DefaultScheduleCount = 5
+
+// MaxScheduleCount maximum number of fire times returned by schedule preview
+const MaxScheduleCount = 100
+
 // JobController user defined background job api controller
 type JobController struct {
 	Controller
@@ -130,5 +140,170 @@ func (c JobController) Delete(ctx *fasthttp.RequestCtx) {
 
 	c.App.Database.Delete(job.TableName(), "id = $1", id).Force()
 
+	if c.App.Scheduler != nil {
+		jobID, _ := utils.ParseInt(id, 10, 64)
+		c.App.Scheduler.Package.Delete(jobID)
+	}
+
 	c.JSONResponse(ctx, nil, fasthttp.StatusNoContent)
 }
+
+// Rollback point the current release of user defined background job to the
+// previous release and run its restart jobs
+func (c JobController) Rollback(ctx *fasthttp.RequestCtx) {
+	detail := new(model2.JobDetail)
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT d.* FROM %s AS d"+
+		" LEFT OUTER JOIN %s AS d2 ON d.job_id = d2.job_id AND d.id < d2.id"+
+		" WHERE d2.id IS NULL AND d.job_id = $1", detail.TableName(), detail.TableName()),
+		detail, phi.URLParam(ctx, "jobID")).Force()
+
+	release, results, err := c.App.Job.Rollback(detail)
+	if err != nil {
+		errs := make(map[string]string)
+		errs["release"] = err.Error()
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	restarted := make([]string, 0)
+	for _, r := range results {
+		restarted = append(restarted, r.Code)
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model.RollbackResponse{
+			Release:   release,
+			Restarted: restarted,
+		},
+	}, fasthttp.StatusOK)
+}
+
+// Schedule next fire times of user defined background job schedule in node
+// timezone. A schedule given with spec query param is previewed instead of
+// the job schedule.
+func (c JobController) Schedule(ctx *fasthttp.RequestCtx) {
+	detail := new(model2.JobDetail)
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT d.* FROM %s AS d"+
+		" LEFT OUTER JOIN %s AS d2 ON d.job_id = d2.job_id AND d.id < d2.id"+
+		" WHERE d2.id IS NULL AND d.job_id = $1", detail.TableName(), detail.TableName()),
+		detail, phi.URLParam(ctx, "jobID")).Force()
+
+	queryParams := c.ParseQuery(ctx)
+	errs := make(map[string]string)
+
+	count := DefaultScheduleCount
+	if val, ok := queryParams["count"]; ok {
+		var err error
+		count, err = strconv.Atoi(val)
+		if err != nil || count <= 0 || count > MaxScheduleCount {
+			errs["count"] = "is not valid"
+			c.JSONResponse(ctx, model.ResponseError{
+				Errors: errs,
+				Detail: fasthttp.StatusMessage(fasthttp.StatusBadRequest),
+			}, fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	spec := detail.Schedule.String
+	if val, ok := queryParams["spec"]; ok {
+		spec = val
+	}
+
+	schedule, err := utils.ParseSchedule(spec)
+	if spec == "" {
+		errs["schedule"] = "job is not scheduled"
+	} else if err != nil {
+		errs["schedule"] = err.Error()
+	}
+	if len(errs) > 0 {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	now := time.Now().In(time.Local)
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model.ScheduleResponse{
+			Schedule: spec,
+			Timezone: now.Location().String(),
+			NextRuns: utils.NextSchedules(schedule, now, count),
+		},
+	}, fasthttp.StatusOK)
+}
+
+// Trigger publish user defined background job to queuing channel so that
+// every subscribed node runs it. Nodes, node types and node tags can be
+// given in request body to run the job only on target nodes.
+func (c JobController) Trigger(ctx *fasthttp.RequestCtx) {
+	detail := new(model2.JobDetail)
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT d.* FROM %s AS d"+
+		" LEFT OUTER JOIN %s AS d2 ON d.job_id = d2.job_id AND d.id < d2.id"+
+		" WHERE d2.id IS NULL AND d.job_id = $1", detail.TableName(), detail.TableName()),
+		detail, phi.URLParam(ctx, "jobID")).Force()
+
+	message := model.NewJobMessage(detail.Code, detail.Type)
+	c.JSONBody(ctx, &message.MessageTargets)
+
+	for _, typ := range message.NodeTypes {
+		if typ != model.Worker && typ != model.Master {
+			errs := make(map[string]string)
+			errs["node_types"] = "is not valid"
+			c.JSONResponse(ctx, model.ResponseError{
+				Errors: errs,
+				Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+			}, fasthttp.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	message.ReplyTo = c.App.Config.NodeName
+
+	rollout := model2.NewRollout(detail.JobID)
+	rollout.NodeID = c.App.Node.ID
+	rollout.MessageID = message.ID
+	rollout.JobName = message.JobName
+	rollout.Targets = model2.RolloutTargets(message.MessageTargets)
+	rollout.ExpiresAt.SetValid(time.Now().UTC().Add(cmn.RolloutTimeout(c.App)))
+	rollout.SourceUserID.SetValid(c.Auth.ID)
+
+	expected, err := cmn.ExpectedNodes(c.App, message.MessageTargets)
+	if err != nil {
+		c.App.Logger.LogError(err, "expected nodes could not be listed: "+detail.Code)
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusInternalServerError),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+	rollout.Expected = expected
+
+	if err := c.App.Database.Insert(new(model2.Rollout), rollout, "id", "inserted_at"); err != nil {
+		c.App.Logger.LogError(err, "rollout could not be created: "+detail.Code)
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusInternalServerError),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if err := c.App.Queue.Publish(message); err != nil {
+		c.App.Logger.LogError(err, "job message could not be published: "+detail.Code)
+		c.App.Database.Delete(rollout.TableName(), "id = $1", rollout.ID)
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable),
+		}, fasthttp.StatusServiceUnavailable)
+		return
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model.TriggerResponse{ReceivedMessage: message, RolloutID: rollout.ID},
+	}, fasthttp.StatusAccepted)
+}
@@ -129,6 +129,151 @@ func (s JobControllerTest) Test_Should_404Error_DeleteJobWithGivenIdentifier() {
 		"if does not exists")
 }
 
+func (s JobControllerTest) Test_Should_422Error_RollbackJobIfThereIsNoPreviousRelease() {
+	job := model.NewJob()
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	job.NodeID = s.API.App.Node.ID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	jobDetail := model.NewJobDetail()
+	jobDetail.NodeID = s.API.App.Node.ID
+	jobDetail.JobID = job.ID
+	jobDetail.Code = "rollbackJob"
+	jobDetail.Name = "jobName"
+	jobDetail.Type = model2.NewRelease
+	err = s.API.App.Database.Insert(new(model.JobDetail), jobDetail, "id")
+	s.Nil(err)
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/rollback", job.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+	errs, _ := resp.Error.Errors.(map[string]interface{})
+	s.NotNil(errs["release"])
+
+	defaultLogger.LogInfo("Should be 422 error rollback a job if there is no previous release")
+}
+
+func (s JobControllerTest) Test_Should_404Error_RollbackJobIfDoesNotExists() {
+	resp := s.JSON(Post, "/api/v1/job/999999999/rollback", nil)
+
+	s.Equal(resp.Status, fasthttp.StatusNotFound)
+
+	defaultLogger.LogInfo("Should be 404 error rollback a job if does not exists")
+}
+
+func (s JobControllerTest) Test_ShowJobScheduleWithGivenIdentifier() {
+	job := model.NewJob()
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	job.NodeID = s.API.App.Node.ID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	jobDetail := model.NewJobDetail()
+	jobDetail.NodeID = s.API.App.Node.ID
+	jobDetail.JobID = job.ID
+	jobDetail.Code = "scheduledJob"
+	jobDetail.Name = "jobName"
+	jobDetail.Type = model2.Other
+	jobDetail.Schedule.SetValid("0 */15 * * * *")
+	err = s.API.App.Database.Insert(new(model.JobDetail), jobDetail, "id")
+	s.Nil(err)
+
+	resp := s.JSON(Get, fmt.Sprintf("/api/v1/job/%d/schedule?count=3", job.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	data := resp.Success.Data.(map[string]interface{})
+	s.Equal(data["schedule"], "0 */15 * * * *")
+	s.Equal(data["timezone"], time.Local.String())
+	s.Len(data["next_runs"], 3)
+
+	resp = s.JSON(Get, fmt.Sprintf("/api/v1/job/%d/schedule?spec=@every+1h", job.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	data = resp.Success.Data.(map[string]interface{})
+	s.Equal(data["schedule"], "@every 1h")
+	s.Len(data["next_runs"], DefaultScheduleCount)
+
+	resp = s.JSON(Get, fmt.Sprintf("/api/v1/job/%d/schedule?spec=every+day", job.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+
+	defaultLogger.LogInfo("Show a job schedule with given identifier")
+}
+
+func (s JobControllerTest) Test_TriggerJobWithGivenIdentifier() {
+	job := model.NewJob()
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	job.NodeID = s.API.App.Node.ID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	jobDetail := model.NewJobDetail()
+	jobDetail.NodeID = s.API.App.Node.ID
+	jobDetail.JobID = job.ID
+	jobDetail.Code = "triggeredJob"
+	jobDetail.Name = "jobName"
+	jobDetail.Type = model2.Other
+	jobDetail.Script.SetValid("echo triggered")
+	err = s.API.App.Database.Insert(new(model.JobDetail), jobDetail, "id")
+	s.Nil(err)
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/trigger", job.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusAccepted)
+	data := resp.Success.Data.(map[string]interface{})
+	s.Equal(data["job_name"], "triggeredJob")
+	s.Equal(data["type"], string(model2.Other))
+	s.NotEmpty(data["id"])
+	s.NotEmpty(data["rollout_id"])
+
+	defaultLogger.LogInfo("Trigger a job with given identifier")
+}
+
+func (s JobControllerTest) Test_TriggerJobOnTargetNodes() {
+	job := model.NewJob()
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	job.NodeID = s.API.App.Node.ID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	jobDetail := model.NewJobDetail()
+	jobDetail.NodeID = s.API.App.Node.ID
+	jobDetail.JobID = job.ID
+	jobDetail.Code = "targetedJob"
+	jobDetail.Name = "jobName"
+	jobDetail.Type = model2.Other
+	jobDetail.Script.SetValid("echo targeted")
+	err = s.API.App.Database.Insert(new(model.JobDetail), jobDetail, "id")
+	s.Nil(err)
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/trigger", job.ID), model2.MessageTargets{
+		NodeTypes: []model2.Node{model2.Worker},
+		Tags:      []string{"web"},
+	})
+
+	s.Equal(resp.Status, fasthttp.StatusAccepted)
+	data := resp.Success.Data.(map[string]interface{})
+	s.Equal(data["node_types"], []interface{}{"worker"})
+	s.Equal(data["tags"], []interface{}{"web"})
+
+	resp = s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/trigger", job.ID), model2.MessageTargets{
+		NodeTypes: []model2.Node{"database"},
+	})
+
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+
+	defaultLogger.LogInfo("Trigger a job on target nodes")
+}
+
+func (s JobControllerTest) Test_Should_404Error_TriggerJobIfDoesNotExists() {
+	resp := s.JSON(Post, "/api/v1/job/999999999/trigger", nil)
+
+	s.Equal(resp.Status, fasthttp.StatusNotFound)
+
+	defaultLogger.LogInfo("Should be 404 error trigger a job if does not exists")
+}
+
 func (s JobControllerTest) TearDownSuite() {
 	TearDownSuite(s.Suite)
 }
@@ -19,6 +19,7 @@ package api
 import (
 	"fmt"
 	"github.com/fate-lovely/phi"
+	"github.com/streetbyters/agente/cmn"
 	"github.com/streetbyters/agente/database"
 	"github.com/streetbyters/agente/database/model"
 	model2 "github.com/streetbyters/agente/model"
@@ -71,6 +72,14 @@ func (c JobDetailController) Create(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	if errs := c.dependencyErrors(jobDetail); errs != nil {
+		c.JSONResponse(ctx, model2.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
 	if err := c.App.Database.Insert(new(model.JobDetail),
 		jobDetail,
 		"id", "inserted_at"); err != nil {
@@ -84,7 +93,50 @@ func (c JobDetailController) Create(ctx *fasthttp.RequestCtx) {
 		}
 	}
 
+	if jobDetail.ScriptFile.String != "" {
+		if err := cmn.PromoteUploads(c.App, c.App.Job.ScriptFile(jobDetail), ""); err != nil {
+			c.App.Logger.LogError(err, "uploads could not be promoted: "+jobDetail.Code)
+		}
+	}
+
+	if c.App.Scheduler != nil {
+		if err := c.App.Scheduler.Package.Update(jobDetail); err != nil {
+			c.App.Logger.LogError(err, "job could not be scheduled: "+jobDetail.Code)
+		}
+	}
+
 	c.JSONResponse(ctx, model2.ResponseSuccessOne{
 		Data: jobDetail,
 	}, fasthttp.StatusCreated)
 }
+
+// dependencyErrors check before/after jobs of given detail for dependency cycles
+func (c JobDetailController) dependencyErrors(jobDetail *model.JobDetail) map[string]string {
+	graph, err := c.App.Job.Graph()
+	if err != nil {
+		graph = cmn.NewJobGraph()
+	}
+	for code, detail := range graph.Details {
+		if detail.JobID == jobDetail.JobID {
+			delete(graph.Details, code)
+		}
+	}
+	graph.Details[jobDetail.Code] = jobDetail
+
+	path := graph.Cycle(jobDetail.Code)
+	if path == nil {
+		return nil
+	}
+
+	field := "code"
+	if ok, _ := utils.InArray(path[1], cmn.AfterJobs(jobDetail)); ok {
+		field = "after_jobs"
+	} else if ok, _ := utils.InArray(path[len(path)-2], cmn.BeforeJobs(jobDetail)); ok {
+		field = "before_jobs"
+	}
+
+	errs := make(map[string]string)
+	errs[field] = (&cmn.CycleError{Path: path}).Error()
+
+	return errs
+}
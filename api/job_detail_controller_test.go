@@ -181,6 +181,108 @@ func (s JobDetailControllerTest) Test_Should_400Error_CreateJobDetailWithValidPa
 	defaultLogger.LogInfo("Should be 400 error create a job detail with valid params")
 }
 
+func (s JobDetailControllerTest) Test_Should_422Error_CreateJobDetailIfDependencyCycle() {
+	job := model.NewJob()
+	job.NodeID = s.API.App.Node.ID
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	detail := model.NewJobDetail()
+	detail.NodeID = s.API.App.Node.ID
+	detail.JobID = job.ID
+	detail.Type = model2.Start
+	detail.Code = "cycle_start"
+	detail.Name = "Start Job"
+	detail.Before = true
+	detail.BeforeJobs.SetValid("cycle_deploy")
+	detail.Script.SetValid("echo start")
+	err = s.API.App.Database.Insert(new(model.JobDetail), detail, "id")
+	s.Nil(err)
+
+	job = model.NewJob()
+	job.NodeID = s.API.App.Node.ID
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	err = s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	detail = model.NewJobDetail()
+	detail.Type = model2.NewRelease
+	detail.Code = "cycle_deploy"
+	detail.Name = "Deploy Job"
+	detail.Before = true
+	detail.BeforeJobs.SetValid("cycle_start")
+	detail.Script.SetValid("echo deploy")
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/detail", job.ID), detail)
+
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+	errs, _ := resp.Error.Errors.(map[string]interface{})
+	s.Equal(errs["before_jobs"], "dependency cycle: cycle_deploy -> cycle_start -> cycle_deploy")
+
+	defaultLogger.LogInfo("Should be 422 error create a job detail if dependency cycle")
+}
+
+func (s JobDetailControllerTest) Test_Should_422Error_CreateJobDetailIfInvalidSchedule() {
+	job := model.NewJob()
+	job.NodeID = s.API.App.Node.ID
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	detail := model.NewJobDetail()
+	detail.Type = model2.Other
+	detail.Code = "scheduled_backup"
+	detail.Name = "Backup Job"
+	detail.Schedule.SetValid("every day")
+	detail.Script.SetValid("echo backup")
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/detail", job.ID), detail)
+
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+	errs, _ := resp.Error.Errors.(map[string]interface{})
+	s.NotNil(errs["schedule"])
+
+	defaultLogger.LogInfo("Should be 422 error create a job detail if invalid schedule")
+}
+
+func (s JobDetailControllerTest) Test_Should_422Error_CreateJobDetailIfProcessTraversesPath() {
+	job := model.NewJob()
+	job.NodeID = s.API.App.Node.ID
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	for _, process := range []string{"../../etc/cron.d/app", "..", "/tmp/app"} {
+		detail := model.NewJobDetail()
+		detail.Type = model2.Start
+		detail.Code = "traversal_start"
+		detail.Name = "Traversal Job"
+		detail.Process.SetValid(process)
+		detail.Script.SetValid("sleep 1")
+
+		resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/detail", job.ID), detail)
+
+		s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+		errs, _ := resp.Error.Errors.(map[string]interface{})
+		s.NotNil(errs["process"])
+	}
+
+	detail := model.NewJobDetail()
+	detail.Type = model2.Start
+	detail.Code = "../traversal"
+	detail.Name = "Traversal Job"
+	detail.Script.SetValid("sleep 1")
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/detail", job.ID), detail)
+
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+	errs, _ := resp.Error.Errors.(map[string]interface{})
+	s.NotNil(errs["code"])
+
+	defaultLogger.LogInfo("Should be 422 error create a job detail if process traverses path")
+}
+
 func (s JobDetailControllerTest) TearDownSuite() {
 	TearDownSuite(s.Suite)
 }
@@ -0,0 +1,72 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"github.com/fate-lovely/phi"
+	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+)
+
+// JobLogController job execution log api controller
+type JobLogController struct {
+	Controller
+	*API
+}
+
+// Index list all job execution logs. Logs of a job are listed if the job
+// is given in url.
+func (c JobLogController) Index(ctx *fasthttp.RequestCtx) {
+	paginate, _, _ := c.Paginate(ctx, "id", "node_id", "state", "inserted_at")
+
+	jobID := phi.URLParam(ctx, "jobID")
+	log := new(model.JobLog)
+	logs := make([]model.JobLog, 0)
+	var count int64
+
+	if jobID != "" {
+		var job model.Job
+		c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", job.TableName()),
+			&job,
+			jobID).Force()
+
+		c.App.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s "+
+			"WHERE job_id = $1 ORDER BY %s %s LIMIT $2 OFFSET $3",
+			log.TableName(), paginate.OrderField, paginate.OrderBy),
+			&logs,
+			jobID,
+			paginate.Limit,
+			paginate.Offset)
+		c.App.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s WHERE job_id = $1",
+			log.TableName()), jobID)
+	} else {
+		c.App.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s "+
+			"ORDER BY %s %s LIMIT $1 OFFSET $2",
+			log.TableName(), paginate.OrderField, paginate.OrderBy),
+			&logs,
+			paginate.Limit,
+			paginate.Offset)
+		c.App.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s", log.TableName()))
+	}
+
+	c.JSONResponse(ctx, model2.ResponseSuccess{
+		Data:       logs,
+		TotalCount: count,
+	}, fasthttp.StatusOK)
+}
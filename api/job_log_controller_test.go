@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"github.com/streetbyters/agente/database/model"
+	"github.com/valyala/fasthttp"
+	"testing"
+	"time"
+)
+
+type JobLogControllerTest struct {
+	*Suite
+}
+
+func (s JobLogControllerTest) SetupSuite() {
+	SetupSuite(s.Suite)
+	UserAuth(s.Suite)
+}
+
+func (s JobLogControllerTest) newJob() *model.Job {
+	job := model.NewJob()
+	job.NodeID = s.API.App.Node.ID
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	return job
+}
+
+func (s JobLogControllerTest) newLog(jobID int64, state bool) *model.JobLog {
+	log := model.NewJobLog(jobID)
+	log.NodeID = s.API.App.Node.ID
+	log.State = state
+	log.Data = model.JobLogData{
+		Code:       "job_log",
+		StartedAt:  time.Now().UTC(),
+		FinishedAt: time.Now().UTC(),
+		Stdout:     "Test Job running",
+	}
+	err := s.API.App.Database.Insert(new(model.JobLog), log, "id", "inserted_at")
+	s.Nil(err)
+
+	return log
+}
+
+func (s JobLogControllerTest) Test_ListAllJobLogs() {
+	for i := 0; i < 50; i++ {
+		job := s.newJob()
+		s.newLog(job.ID, true)
+	}
+
+	response := s.JSON(Get, "/api/v1/job/log", nil)
+
+	s.Equal(response.Status, fasthttp.StatusOK)
+	s.Greater(response.Success.TotalCount, int64(49))
+	data, _ := response.Success.Data.([]interface{})
+	s.Equal(len(data), 40)
+	defaultLogger.LogInfo("List all job logs")
+}
+
+func (s JobLogControllerTest) Test_ListAllJobLogsWithJobIDParam() {
+	job := s.newJob()
+	for i := 0; i < 20; i++ {
+		s.newLog(job.ID, i%2 == 0)
+	}
+
+	response := s.JSON(Get, fmt.Sprintf("/api/v1/job/%d/log?limit=10&order_field=inserted_at", job.ID), nil)
+
+	s.Equal(response.Status, fasthttp.StatusOK)
+	s.Equal(response.Success.TotalCount, int64(20))
+	data, _ := response.Success.Data.([]interface{})
+	s.Equal(len(data), 10)
+	log, _ := data[0].(map[string]interface{})
+	s.Equal(log["job_id"], float64(job.ID))
+	s.Equal(log["data"].(map[string]interface{})["stdout"], "Test Job running")
+	defaultLogger.LogInfo("List all job logs with job identifier")
+}
+
+func (s JobLogControllerTest) Test_Should_400Error_ListAllJobLogsWithInvalidOrderField() {
+	response := s.JSON(Get, "/api/v1/job/log?order_field=data", nil)
+
+	s.Equal(response.Status, fasthttp.StatusBadRequest)
+	defaultLogger.LogInfo("Should be 400 error list all job logs with invalid order field")
+}
+
+func (s JobLogControllerTest) Test_Should_404Error_ListAllJobLogsIfJobDoesNotExists() {
+	response := s.JSON(Get, "/api/v1/job/999999999/log", nil)
+
+	s.Equal(response.Status, fasthttp.StatusNotFound)
+	defaultLogger.LogInfo("Should be 404 error list all job logs if job does not exists")
+}
+
+func (s JobLogControllerTest) TearDownSuite() {
+	TearDownSuite(s.Suite)
+}
+
+func Test_JobLogController(t *testing.T) {
+	s := JobLogControllerTest{NewSuite()}
+	Run(t, s)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/fate-lovely/phi"
 	"github.com/streetbyters/agente/model"
 	"github.com/valyala/fasthttp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -62,6 +63,19 @@ func (a JWTAuth) Generate(args ...interface{}) (string, error) {
 	return tokenString, nil
 }
 
+// GenerateFile generate jwt token which only grants access to the content
+// of the file with given identifier
+func (a JWTAuth) GenerateFile(fileID int64, expire time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"file": fileID,
+		"exp":  time.Now().UTC().Add(expire).Unix(),
+	}
+
+	token := jwt.NewWithClaims(a.Method, claims)
+
+	return token.SignedString([]byte(a.Secret))
+}
+
 // Parse token string parse mapClaims expire check
 func (a JWTAuth) Parse(tokenString string) (map[string]interface{}, int) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -113,7 +127,61 @@ func (a JWTAuth) Verify(next phi.HandlerFunc) phi.HandlerFunc {
 			}, fasthttp.StatusForbidden)
 			return
 		default:
-			a.API.Auth.ID = int64(claims["id"].(float64))
+			id, ok := claims["id"].(float64)
+			if !ok {
+				a.API.JSONResponse(ctx, model.ResponseError{
+					Detail: "the token supplied could not be validated.",
+				}, fasthttp.StatusForbidden)
+				return
+			}
+			a.API.Auth.ID = int64(id)
+
+			next(ctx)
+			break
+		}
+	}
+}
+
+// VerifyFile verify bearer token in file content requests. User tokens and
+// file tokens generated for the requested file are accepted.
+func (a JWTAuth) VerifyFile(next phi.HandlerFunc) phi.HandlerFunc {
+	return func(ctx *fasthttp.RequestCtx) {
+		h := ctx.Request.Header.Peek("authorization")
+
+		if len(h) < 7 || strings.ToUpper(string(h)[0:6]) != "BEARER" {
+			a.API.JSONResponse(ctx, model.ResponseError{
+				Detail: "the request sent did not consist a valid token entry.",
+			}, fasthttp.StatusForbidden)
+			return
+		}
+
+		claims, err := a.Parse(string(h)[7:])
+
+		switch err {
+		case 0:
+			a.API.JSONResponse(ctx, model.ResponseError{
+				Detail: "token expire",
+			}, fasthttp.StatusUnauthorized)
+			return
+		case -1, -2:
+			a.API.JSONResponse(ctx, model.ResponseError{
+				Detail: "the token supplied could not be validated.",
+			}, fasthttp.StatusForbidden)
+			return
+		default:
+			if id, ok := claims["id"].(float64); ok {
+				a.API.Auth.ID = int64(id)
+				next(ctx)
+				return
+			}
+
+			fileID, ok := claims["file"].(float64)
+			if !ok || strconv.FormatInt(int64(fileID), 10) != phi.URLParam(ctx, "fileID") {
+				a.API.JSONResponse(ctx, model.ResponseError{
+					Detail: "the token supplied could not be validated.",
+				}, fasthttp.StatusForbidden)
+				return
+			}
 
 			next(ctx)
 			break
@@ -0,0 +1,271 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"github.com/fate-lovely/phi"
+	"github.com/streetbyters/agente/database"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"time"
+)
+
+// NodeController registered master and worker nodes api controller
+type NodeController struct {
+	Controller
+	*API
+}
+
+// Index list all nodes. Nodes can be filtered by state and type.
+func (c NodeController) Index(ctx *fasthttp.RequestCtx) {
+	paginate, _, _ := c.Paginate(ctx, "id", "name", "code", "type", "state", "last_seen_at", "inserted_at")
+	queryParams := c.ParseQuery(ctx)
+
+	node := model2.NewNode()
+	nodes := make([]model2.Node, 0)
+	var count int64
+
+	where := "WHERE ($1 = '' OR state::text = $1) AND ($2 = '' OR type::text = $2)"
+	c.App.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s %s ORDER BY %s %s LIMIT $3 OFFSET $4",
+		node.TableName(), where, paginate.OrderField, paginate.OrderBy),
+		&nodes,
+		queryParams["state"],
+		queryParams["type"],
+		paginate.Limit,
+		paginate.Offset)
+	err := c.App.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s %s", node.TableName(), where),
+		queryParams["state"],
+		queryParams["type"])
+	if err != nil {
+		c.App.Logger.LogError(err, "nodes could not be counted")
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusInternalServerError),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccess{
+		Data:       nodes,
+		TotalCount: count,
+	}, fasthttp.StatusOK)
+}
+
+// Show a node
+func (c NodeController) Show(ctx *fasthttp.RequestCtx) {
+	node := model2.NewNode()
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", node.TableName()),
+		node,
+		phi.URLParam(ctx, "nodeID")).Force()
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: node,
+	}, fasthttp.StatusOK)
+}
+
+// Create a node. Node is offline until it sends a heartbeat.
+func (c NodeController) Create(ctx *fasthttp.RequestCtx) {
+	nodeRequest := model2.NewNode()
+	c.JSONBody(ctx, &nodeRequest)
+
+	node := model2.NewNode()
+	node.Name = nodeRequest.Name
+	node.Code = nodeRequest.Code
+	node.Type = nodeRequest.Type
+	node.Detail = nodeRequest.Detail
+	node.Tags = nodeRequest.Tags
+
+	if errs, err := database.ValidateStruct(node); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	err := c.App.Database.Insert(new(model2.Node), node, "id", "inserted_at", "updated_at")
+	if errs, err := database.ValidateConstraint(err, node); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: node,
+	}, fasthttp.StatusCreated)
+}
+
+// Update name, detail and tags of a node
+func (c NodeController) Update(ctx *fasthttp.RequestCtx) {
+	node := model2.NewNode()
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", node.TableName()),
+		node,
+		phi.URLParam(ctx, "nodeID")).Force()
+
+	nodeRequest := *node
+	nodeRequest.Tags = nil
+	c.JSONBody(ctx, &nodeRequest)
+	if nodeRequest.Tags == nil {
+		nodeRequest.Tags = node.Tags
+	}
+
+	nodeRequest.Code = node.Code
+	nodeRequest.Type = node.Type
+	nodeRequest.Version = node.Version
+	nodeRequest.Address = node.Address
+	nodeRequest.Capabilities = node.Capabilities
+	nodeRequest.State = node.State
+	nodeRequest.LastSeenAt = node.LastSeenAt
+	nodeRequest.UpdatedAt = time.Now().UTC()
+
+	if errs, err := database.ValidateStruct(nodeRequest); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	err := c.App.Database.Update(node, &nodeRequest, nil, "id", "updated_at")
+	if errs, err := database.ValidateConstraint(err, &nodeRequest); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: node,
+	}, fasthttp.StatusOK)
+}
+
+// Delete decommission a node. Node owning jobs, files, uploads or logs is
+// not deleted unless force is set, because they are deleted with the node.
+// Online node is not deleted unless force is set either, because its next
+// heartbeat registers it again. Users of the node and their passphrases
+// are moved to the current node.
+func (c NodeController) Delete(ctx *fasthttp.RequestCtx) {
+	node := model2.NewNode()
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", node.TableName()),
+		node,
+		phi.URLParam(ctx, "nodeID")).Force()
+
+	if node.ID == c.App.Node.ID {
+		errs := make(map[string]string)
+		errs["node"] = "current node can not be decommissioned"
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	force, _ := strconv.ParseBool(c.ParseQuery(ctx)["force"])
+	errs, err := c.owned(node)
+	if err != nil {
+		c.App.Logger.LogError(err, "node records could not be counted: "+node.Code)
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusInternalServerError),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+	if node.State == model.NodeOnline {
+		errs["state"] = "node is online and would be registered again by its heartbeat"
+	}
+	if len(errs) > 0 && !force {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusConflict),
+		}, fasthttp.StatusConflict)
+		return
+	}
+
+	user := new(model2.User)
+	tx, err := c.App.Database.DB.Beginx()
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET node_id = $1 WHERE node_id = $2", user.TableName()),
+			c.App.Node.ID, node.ID)
+	}
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET node_id = $1 WHERE node_id = $2",
+			new(model2.UserPassphrase).TableName()),
+			c.App.Node.ID, node.ID)
+	}
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET node_id = $1 WHERE node_id = $2",
+			new(model2.UserPassphraseInvalidation).TableName()),
+			c.App.Node.ID, node.ID)
+	}
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1", node.TableName()), node.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else if tx != nil {
+		tx.Rollback()
+	}
+	if err != nil {
+		c.App.Logger.LogError(err, "node could not be decommissioned: "+node.Code)
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusInternalServerError),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	c.App.Logger.LogInfo("Decommissioned node: " + node.Code)
+
+	c.JSONResponse(ctx, nil, fasthttp.StatusNoContent)
+}
+
+// owned records of the node deleted with it. Every table referencing
+// the node with a cascading delete is checked, except the user tables
+// which are moved to the current node.
+func (c NodeController) owned(node *model2.Node) (map[string]string, error) {
+	tables := map[string]string{
+		"jobs":            new(model2.Job).TableName(),
+		"job_details":     new(model2.JobDetail).TableName(),
+		"job_logs":        new(model2.JobLog).TableName(),
+		"files":           new(model2.File).TableName(),
+		"file_logs":       new(model2.FileLog).TableName(),
+		"file_versions":   new(model2.FileVersion).TableName(),
+		"uploads":         new(model2.Upload).TableName(),
+		"upload_sessions": new(model2.UploadSession).TableName(),
+		"rollouts":        new(model2.Rollout).TableName(),
+	}
+
+	errs := make(map[string]string)
+	for key, table := range tables {
+		var count int64
+		if err := c.App.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s WHERE node_id = $1",
+			table), node.ID); err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			errs[key] = fmt.Sprintf("node owns %d records", count)
+		}
+	}
+
+	return errs, nil
+}
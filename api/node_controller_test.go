@@ -0,0 +1,277 @@
+package api
+
+import (
+	"fmt"
+	"github.com/streetbyters/agente/cmn"
+	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"testing"
+	"time"
+)
+
+type NodeControllerTest struct {
+	*Suite
+}
+
+func (s NodeControllerTest) SetupSuite() {
+	SetupSuite(s.Suite)
+	UserAuth(s.Suite)
+}
+
+func (s NodeControllerTest) Test_ListAllNodes() {
+	_, err := cmn.TouchNode(s.API.App, &model2.NodeHeartbeat{
+		Node:         "node_worker@listed",
+		Type:         model2.Worker,
+		Version:      cmn.Version,
+		Address:      "listed:3002",
+		Capabilities: []string{"other"},
+	})
+	s.Nil(err)
+
+	resp := s.JSON(Get, "/api/v1/node", nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	s.Greater(resp.Success.TotalCount, int64(1))
+
+	resp = s.JSON(Get, "/api/v1/node?state=online&type=worker", nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	for _, n := range resp.Success.Data.([]interface{}) {
+		node := n.(map[string]interface{})
+		s.Equal(node["state"], string(model2.NodeOnline))
+		s.Equal(node["type"], string(model2.Worker))
+	}
+
+	defaultLogger.LogInfo("List all nodes")
+}
+
+func (s NodeControllerTest) Test_ShowNodeWithGivenIdentifier() {
+	resp := s.JSON(Get, fmt.Sprintf("/api/v1/node/%d", s.API.App.Node.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	node := resp.Success.Data.(map[string]interface{})
+	s.Equal(node["code"], s.API.App.Config.NodeName)
+	s.Equal(node["version"], cmn.Version)
+	s.Equal(node["state"], string(model2.NodeOnline))
+	s.NotEmpty(node["capabilities"])
+
+	defaultLogger.LogInfo("Show a node with given identifier")
+}
+
+func (s NodeControllerTest) Test_MarkNodesMissedHeartbeatsOffline() {
+	node, err := cmn.TouchNode(s.API.App, &model2.NodeHeartbeat{
+		Node:    "node_worker@offline",
+		Type:    model2.Worker,
+		Version: cmn.Version,
+	})
+	s.Nil(err)
+	s.Equal(node.State, model2.NodeOnline)
+
+	codes, err := cmn.MarkOfflineNodes(s.API.App, time.Now().UTC().Add(time.Minute))
+	s.Nil(err)
+	s.Contains(codes, "node_worker@offline")
+
+	resp := s.JSON(Get, fmt.Sprintf("/api/v1/node/%d", node.ID), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	s.Equal(resp.Success.Data.(map[string]interface{})["state"], string(model2.NodeOffline))
+
+	_, err = cmn.RegisterNode(s.API.App)
+	s.Nil(err)
+
+	defaultLogger.LogInfo("Mark nodes missed heartbeats offline")
+}
+
+func (s NodeControllerTest) Test_Should_404Error_ShowNodeIfDoesNotExists() {
+	resp := s.JSON(Get, "/api/v1/node/999999999", nil)
+
+	s.Equal(resp.Status, fasthttp.StatusNotFound)
+
+	defaultLogger.LogInfo("Should be 404 error show a node if does not exists")
+}
+
+func (s NodeControllerTest) newNode(code string) map[string]interface{} {
+	resp := s.JSON(Post, "/api/v1/node", map[string]interface{}{
+		"name":   "Worker Node",
+		"code":   code,
+		"type":   "worker",
+		"detail": "web server",
+		"tags":   []string{"web", "eu"},
+	})
+	s.Equal(resp.Status, fasthttp.StatusCreated)
+
+	return resp.Success.Data.(map[string]interface{})
+}
+
+func (s NodeControllerTest) Test_CreateNode() {
+	node := s.newNode("node_worker@created")
+
+	s.Equal(node["code"], "node_worker@created")
+	s.Equal(node["type"], string(model2.Worker))
+	s.Equal(node["state"], string(model2.NodeOffline))
+	s.Equal(node["tags"], []interface{}{"web", "eu"})
+
+	resp := s.JSON(Post, "/api/v1/node", map[string]interface{}{
+		"name": "Worker Node",
+		"code": "node_worker@created",
+	})
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+
+	resp = s.JSON(Post, "/api/v1/node", map[string]interface{}{
+		"name": "Database Node",
+		"code": "node_database@created",
+		"type": "database",
+	})
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+
+	defaultLogger.LogInfo("Create a node")
+}
+
+func (s NodeControllerTest) Test_UpdateNode() {
+	node := s.newNode("node_worker@updated")
+	path := fmt.Sprintf("/api/v1/node/%d", int64(node["id"].(float64)))
+
+	resp := s.JSON(Put, path, map[string]interface{}{
+		"name": "Renamed Node",
+		"code": "node_worker@renamed",
+		"tags": []string{"db"},
+	})
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	data := resp.Success.Data.(map[string]interface{})
+	s.Equal(data["name"], "Renamed Node")
+	s.Equal(data["code"], "node_worker@updated")
+	s.Equal(data["detail"], "web server")
+	s.Equal(data["tags"], []interface{}{"db"})
+
+	resp = s.JSON(Put, path, map[string]interface{}{
+		"detail": "database server",
+	})
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	data = resp.Success.Data.(map[string]interface{})
+	s.Equal(data["detail"], "database server")
+	s.Equal(data["tags"], []interface{}{"db"})
+
+	defaultLogger.LogInfo("Update a node")
+}
+
+func (s NodeControllerTest) Test_DecommissionNode() {
+	node := s.newNode("node_worker@decommissioned")
+	nodeID := int64(node["id"].(float64))
+
+	job := model.NewJob()
+	job.NodeID = nodeID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	user := model.NewUser("1234")
+	user.Username = "decommissionedUser"
+	user.Email = "decommissioned@tecpor.com"
+	user.NodeID = nodeID
+	err = s.API.App.Database.Insert(new(model.User), user, "id", "inserted_at")
+	s.Nil(err)
+
+	path := fmt.Sprintf("/api/v1/node/%d", nodeID)
+	resp := s.JSON(Delete, path, nil)
+
+	s.Equal(resp.Status, fasthttp.StatusConflict)
+	s.NotEmpty(resp.Error.Errors.(map[string]interface{})["jobs"])
+
+	resp = s.JSON(Delete, path+"?force=true", nil)
+	s.Equal(resp.Status, fasthttp.StatusNoContent)
+
+	resp = s.JSON(Get, path, nil)
+	s.Equal(resp.Status, fasthttp.StatusNotFound)
+
+	var userNodeID int64
+	err = s.API.App.Database.DB.Get(&userNodeID, "SELECT node_id FROM ra_users WHERE id = $1", user.ID)
+	s.Nil(err)
+	s.Equal(userNodeID, s.API.App.Node.ID)
+
+	node = s.newNode("node_worker@empty")
+	resp = s.JSON(Delete, fmt.Sprintf("/api/v1/node/%d", int64(node["id"].(float64))), nil)
+	s.Equal(resp.Status, fasthttp.StatusNoContent)
+
+	resp = s.JSON(Delete, fmt.Sprintf("/api/v1/node/%d", s.API.App.Node.ID), nil)
+	s.Equal(resp.Status, fasthttp.StatusUnprocessableEntity)
+
+	defaultLogger.LogInfo("Decommission a node")
+}
+
+func (s NodeControllerTest) Test_Should_409Error_DecommissionNodeOwningJobDetailOrUpload() {
+	node := s.newNode("node_worker@detail")
+	nodeID := int64(node["id"].(float64))
+
+	job := model.NewJob()
+	job.NodeID = s.API.App.Node.ID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	jobDetail := model.NewJobDetail()
+	jobDetail.NodeID = nodeID
+	jobDetail.JobID = job.ID
+	jobDetail.Code = "ownedDetail"
+	jobDetail.Name = "ownedDetail"
+	jobDetail.Type = model2.Other
+	err = s.API.App.Database.Insert(new(model.JobDetail), jobDetail, "id")
+	s.Nil(err)
+
+	resp := s.JSON(Delete, fmt.Sprintf("/api/v1/node/%d", nodeID), nil)
+	s.Equal(resp.Status, fasthttp.StatusConflict)
+	s.NotEmpty(resp.Error.Errors.(map[string]interface{})["job_details"])
+
+	node = s.newNode("node_worker@upload")
+	nodeID = int64(node["id"].(float64))
+
+	upload := model.NewUpload(nodeID)
+	upload.Dir = "/tmp"
+	upload.File = "owned.txt"
+	upload.Checksum = "owned"
+	upload.ExpiresAt = time.Now().UTC().Add(time.Hour)
+	err = s.API.App.Database.Insert(new(model.Upload), upload, "id", "inserted_at", "updated_at")
+	s.Nil(err)
+
+	resp = s.JSON(Delete, fmt.Sprintf("/api/v1/node/%d", nodeID), nil)
+	s.Equal(resp.Status, fasthttp.StatusConflict)
+	s.NotEmpty(resp.Error.Errors.(map[string]interface{})["uploads"])
+
+	var count int64
+	err = s.API.App.Database.DB.Get(&count, "SELECT count(*) FROM ra_uploads WHERE id = $1", upload.ID)
+	s.Nil(err)
+	s.Equal(count, int64(1))
+
+	defaultLogger.LogInfo("Should be 409 error decommission a node owning a job detail or an upload")
+}
+
+func (s NodeControllerTest) Test_Should_409Error_DecommissionOnlineNode() {
+	node, err := cmn.TouchNode(s.API.App, &model2.NodeHeartbeat{
+		Node:    "node_worker@online",
+		Type:    model2.Worker,
+		Version: cmn.Version,
+	})
+	s.Nil(err)
+
+	path := fmt.Sprintf("/api/v1/node/%d", node.ID)
+	resp := s.JSON(Delete, path, nil)
+	s.Equal(resp.Status, fasthttp.StatusConflict)
+	s.NotEmpty(resp.Error.Errors.(map[string]interface{})["state"])
+
+	resp = s.JSON(Get, path, nil)
+	s.Equal(resp.Status, fasthttp.StatusOK)
+
+	resp = s.JSON(Delete, path+"?force=true", nil)
+	s.Equal(resp.Status, fasthttp.StatusNoContent)
+
+	defaultLogger.LogInfo("Should be 409 error decommission an online node")
+}
+
+func (s NodeControllerTest) TearDownSuite() {
+	TearDownSuite(s.Suite)
+}
+
+func Test_NodeController(t *testing.T) {
+	s := NodeControllerTest{Suite: NewSuite()}
+	Run(t, s)
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"github.com/fate-lovely/phi"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"time"
+)
+
+// RolloutController triggered job rollout api controller
+type RolloutController struct {
+	Controller
+	*API
+}
+
+// Show a rollout with job results of the nodes
+func (c RolloutController) Show(ctx *fasthttp.RequestCtx) {
+	rollout := new(model2.Rollout)
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", rollout.TableName()),
+		rollout,
+		phi.URLParam(ctx, "rolloutID")).Force()
+
+	result := new(model2.RolloutResult)
+	var results []model2.RolloutResult
+	c.App.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s WHERE rollout_id = $1 ORDER BY node ASC",
+		result.TableName()),
+		&results,
+		rollout.ID)
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model2.NewRolloutSummary(rollout, results, time.Now().UTC()),
+	}, fasthttp.StatusOK)
+}
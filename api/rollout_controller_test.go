@@ -0,0 +1,178 @@
+package api
+
+import (
+	"fmt"
+	"github.com/streetbyters/agente/cmn"
+	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"testing"
+	"time"
+)
+
+type RolloutControllerTest struct {
+	*Suite
+}
+
+func (s RolloutControllerTest) SetupSuite() {
+	SetupSuite(s.Suite)
+	UserAuth(s.Suite)
+}
+
+func (s RolloutControllerTest) trigger(code string, nodes ...string) map[string]interface{} {
+	if len(nodes) == 0 {
+		nodes = []string{"node_worker@rollout"}
+	}
+
+	job := model.NewJob()
+	job.SourceUserID.SetValid(s.Auth.User.ID)
+	job.NodeID = s.API.App.Node.ID
+	err := s.API.App.Database.Insert(new(model.Job), job, "id", "inserted_at")
+	s.Nil(err)
+
+	jobDetail := model.NewJobDetail()
+	jobDetail.NodeID = s.API.App.Node.ID
+	jobDetail.JobID = job.ID
+	jobDetail.Code = code
+	jobDetail.Name = "jobName"
+	jobDetail.Type = model2.Other
+	jobDetail.Script.SetValid("echo " + code)
+	err = s.API.App.Database.Insert(new(model.JobDetail), jobDetail, "id")
+	s.Nil(err)
+
+	resp := s.JSON(Post, fmt.Sprintf("/api/v1/job/%d/trigger", job.ID), model2.MessageTargets{
+		Nodes: nodes,
+	})
+	s.Equal(resp.Status, fasthttp.StatusAccepted)
+
+	data := resp.Success.Data.(map[string]interface{})
+	s.Equal(data["reply_to"], s.API.App.Config.NodeName)
+	s.NotEmpty(data["rollout_id"])
+
+	return data
+}
+
+func (s RolloutControllerTest) Test_ShowRolloutWithGivenIdentifier() {
+	data := s.trigger("rolloutJob")
+
+	resp := s.JSON(Get, fmt.Sprintf("/api/v1/rollout/%d", int64(data["rollout_id"].(float64))), nil)
+
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	rollout := resp.Success.Data.(map[string]interface{})
+	s.Equal(rollout["message_id"], data["id"])
+	s.Equal(rollout["job_name"], "rolloutJob")
+	s.Equal(rollout["status"], string(model2.RolloutPending))
+	s.Equal(rollout["results"], []interface{}{})
+
+	defaultLogger.LogInfo("Show a rollout with given identifier")
+}
+
+func (s RolloutControllerTest) Test_CollectJobRepliesOfRollout() {
+	data := s.trigger("collectedJob")
+	messageID := data["id"].(string)
+
+	_, err := cmn.Collect(s.API.App, &model2.JobReply{
+		MessageID: messageID,
+		Node:      "node_worker@rollout",
+		Status:    model2.RolloutFailed,
+		ExitCode:  1,
+		Error:     "exit status 1",
+	})
+	s.Nil(err)
+
+	path := fmt.Sprintf("/api/v1/rollout/%d", int64(data["rollout_id"].(float64)))
+	resp := s.JSON(Get, path, nil)
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	rollout := resp.Success.Data.(map[string]interface{})
+	s.Equal(rollout["status"], string(model2.RolloutFailed))
+	s.Equal(rollout["failed"], float64(1))
+
+	_, err = cmn.Collect(s.API.App, &model2.JobReply{
+		MessageID: messageID,
+		Node:      "node_worker@rollout",
+		RunID:     1,
+		Status:    model2.RolloutSucceeded,
+		Duration:  120,
+	})
+	s.Nil(err)
+
+	resp = s.JSON(Get, path, nil)
+	rollout = resp.Success.Data.(map[string]interface{})
+	s.Equal(rollout["status"], string(model2.RolloutSucceeded))
+	s.Equal(rollout["succeeded"], float64(1))
+	s.Equal(rollout["failed"], float64(0))
+	results := rollout["results"].([]interface{})
+	s.Equal(len(results), 1)
+	s.Equal(results[0].(map[string]interface{})["duration"], float64(120))
+
+	_, err = cmn.Collect(s.API.App, &model2.JobReply{MessageID: "unknown", Node: "node_worker@rollout"})
+	s.NotNil(err)
+
+	defaultLogger.LogInfo("Collect job replies of a rollout")
+}
+
+func (s RolloutControllerTest) Test_KeepRolloutPendingUntilEveryExpectedNodeReplies() {
+	data := s.trigger("partialJob", "node_a@rollout", "node_b@rollout")
+	messageID := data["id"].(string)
+	rolloutID := int64(data["rollout_id"].(float64))
+
+	_, err := cmn.Collect(s.API.App, &model2.JobReply{
+		MessageID: messageID,
+		Node:      "node_a@rollout",
+		RunID:     1,
+		Status:    model2.RolloutSucceeded,
+	})
+	s.Nil(err)
+
+	path := fmt.Sprintf("/api/v1/rollout/%d", rolloutID)
+	resp := s.JSON(Get, path, nil)
+	s.Equal(resp.Status, fasthttp.StatusOK)
+	rollout := resp.Success.Data.(map[string]interface{})
+	s.Equal(rollout["status"], string(model2.RolloutPending))
+	s.Equal(rollout["succeeded"], float64(1))
+	s.Equal(rollout["expected"], []interface{}{"node_a@rollout", "node_b@rollout"})
+	s.Equal(rollout["missing"], []interface{}{"node_b@rollout"})
+
+	_, err = s.API.App.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET expires_at = $1 WHERE id = $2",
+		new(model.Rollout).TableName()),
+		time.Now().UTC().Add(-time.Minute), rolloutID)
+	s.Nil(err)
+
+	resp = s.JSON(Get, path, nil)
+	rollout = resp.Success.Data.(map[string]interface{})
+	s.Equal(rollout["status"], string(model2.RolloutFailed))
+	s.Equal(rollout["missing"], []interface{}{"node_b@rollout"})
+
+	_, err = cmn.Collect(s.API.App, &model2.JobReply{
+		MessageID: messageID,
+		Node:      "node_b@rollout",
+		RunID:     1,
+		Status:    model2.RolloutSucceeded,
+	})
+	s.Nil(err)
+
+	resp = s.JSON(Get, path, nil)
+	rollout = resp.Success.Data.(map[string]interface{})
+	s.Equal(rollout["status"], string(model2.RolloutSucceeded))
+	s.Equal(rollout["succeeded"], float64(2))
+	s.Equal(rollout["missing"], []interface{}{})
+
+	defaultLogger.LogInfo("Keep rollout pending until every expected node replies")
+}
+
+func (s RolloutControllerTest) Test_Should_404Error_ShowRolloutIfDoesNotExists() {
+	resp := s.JSON(Get, "/api/v1/rollout/999999999", nil)
+
+	s.Equal(resp.Status, fasthttp.StatusNotFound)
+
+	defaultLogger.LogInfo("Should be 404 error show a rollout if does not exists")
+}
+
+func (s RolloutControllerTest) TearDownSuite() {
+	TearDownSuite(s.Suite)
+}
+
+func Test_RolloutController(t *testing.T) {
+	s := RolloutControllerTest{Suite: NewSuite()}
+	Run(t, s)
+}
@@ -44,8 +44,8 @@ type Router struct {
 var (
 	prefix           string
 	reqID            uint64
-	allowHeaders     = "authorization"
-	allowMethods     = "HEAD,GET,POST,PUT,DELETE,OPTIONS"
+	allowHeaders     = "authorization,content-type,range,if-range,if-none-match,upload-length,upload-offset,upload-metadata,tus-resumable"
+	allowMethods     = "HEAD,GET,POST,PUT,PATCH,DELETE,OPTIONS"
 	allowOrigin      = "*"
 	allowCredentials = "true"
 )
@@ -81,6 +81,7 @@ func NewRouter(api *API) *Router {
 	r.MethodNotAllowed(router.methodNotAllowed)
 
 	r.Get("/", HomeController{API: api}.Index)
+	r.Get("/health", HomeController{API: api}.Health)
 
 	r.Route("/api/v1", func(r phi.Router) {
 		r.Route("/user", func(r phi.Router) {
@@ -88,15 +89,23 @@ func NewRouter(api *API) *Router {
 			r.Post("/token", TokenController{API: api}.Create)
 		})
 
+		r.With(api.JWTAuth.VerifyFile).Get("/file/{fileID}/content", FileController{API: api}.Content)
+		r.With(api.JWTAuth.VerifyFile).Head("/file/{fileID}/content", FileController{API: api}.Content)
+
 		r.Group(func(r phi.Router) {
 			r.Use(api.JWTAuth.Verify)
 			// Job Routes
 			r.Group(func(r phi.Router) {
+				r.Get("/job/log", JobLogController{API: api}.Index)
 				r.Get("/job", JobController{API: api}.Index)
 				r.Post("/job", JobController{API: api}.Create)
 				r.Route("/job/{jobID}", func(r phi.Router) {
+					r.Get("/log", JobLogController{API: api}.Index)
 					r.Get("/", JobController{API: api}.Show)
 					r.Delete("/", JobController{API: api}.Delete)
+					r.Post("/rollback", JobController{API: api}.Rollback)
+					r.Get("/schedule", JobController{API: api}.Schedule)
+					r.Post("/trigger", JobController{API: api}.Trigger)
 
 					// Detail Routes
 					r.Route("/detail", func(r phi.Router) {
@@ -115,11 +124,39 @@ func NewRouter(api *API) *Router {
 					r.Get("/", FileController{API: api}.Show)
 					r.Put("/", FileController{API: api}.Update)
 					r.Delete("/", FileController{API: api}.Delete)
+					r.Post("/distribute", FileController{API: api}.Distribute)
+					r.Get("/version", FileVersionController{API: api}.Index)
+					r.Route("/version/{version}", func(r phi.Router) {
+						r.Get("/", FileVersionController{API: api}.Show)
+						r.Get("/diff", FileVersionController{API: api}.Diff)
+						r.Post("/restore", FileVersionController{API: api}.Restore)
+					})
 				})
 			})
 
+			// Node Routes
+			r.Get("/node", NodeController{API: api}.Index)
+			r.Post("/node", NodeController{API: api}.Create)
+			r.Route("/node/{nodeID}", func(r phi.Router) {
+				r.Get("/", NodeController{API: api}.Show)
+				r.Put("/", NodeController{API: api}.Update)
+				r.Delete("/", NodeController{API: api}.Delete)
+			})
+
+			// Rollout Routes
+			r.Get("/rollout/{rolloutID}", RolloutController{API: api}.Show)
+
 			r.Get("/upload/dir", UploadController{API: api}.DirIndex)
 			r.Post("/upload", UploadController{API: api}.Create)
+			r.Post("/upload/session", UploadSessionController{API: api}.Create)
+			r.Route("/upload/session/{sessionID}", func(r phi.Router) {
+				r.Get("/", UploadSessionController{API: api}.Show)
+				r.Head("/", UploadSessionController{API: api}.Head)
+				r.Patch("/", UploadSessionController{API: api}.Patch)
+				r.Put("/", UploadSessionController{API: api}.Patch)
+				r.Post("/finish", UploadSessionController{API: api}.Finish)
+				r.Delete("/", UploadSessionController{API: api}.Delete)
+			})
 		})
 	})
 
@@ -229,6 +266,9 @@ func (r Router) cors(next phi.HandlerFunc) phi.HandlerFunc {
 			ctx.Response.Header.Set("Access-Control-Allow-Headers", allowHeaders)
 			ctx.Response.Header.Set("Access-Control-Allow-Methods", allowMethods)
 			ctx.Response.Header.Set("Access-Control-Allow-Origin", allowOrigin)
+			ctx.Response.Header.Set("Tus-Resumable", TusVersion)
+			ctx.Response.Header.Set("Tus-Version", TusVersion)
+			ctx.Response.Header.Set("Tus-Extension", TusExtensions)
 			ctx.Response.Header.Set("Accept", "application/json")
 			ctx.Response.Header.Set("Accept", "multipart/form-data")
 
@@ -69,6 +69,10 @@ const (
 	Put Method = "PUT"
 	// Delete method for api request
 	Delete Method = "DELETE"
+	// Head method for api request
+	Head Method = "HEAD"
+	// Patch method for api request
+	Patch Method = "PATCH"
 )
 
 // ContentType request content type for test api request
@@ -115,30 +119,48 @@ func NewSuite() *Suite {
 	cmn.FailOnError(logger, err)
 
 	config := &model.Config{
-		NodeType:     model.Node(viper.GetString("TYPE")),
-		Path:         appPath,
-		LibPath:      path.Join(appPath, "files"),
-		Port:         viper.GetInt("PORT"),
-		SecretKey:    viper.GetString("SECRET_KEY"),
-		DB:           model.DB(viper.GetString("DB")),
-		DBPath:       dbPath,
-		DBName:       viper.GetString("DB_NAME"),
-		DBHost:       viper.GetString("DB_HOST"),
-		DBPort:       viper.GetInt("DB_PORT"),
-		DBUser:       viper.GetString("DB_USER"),
-		DBPass:       viper.GetString("DB_PASS"),
-		DBSsl:        viper.GetString("DB_SSL"),
-		RabbitMqHost: viper.GetString("RABBITMQ_HOST"),
-		RabbitMqPort: viper.GetInt("RABBITMQ_PORT"),
-		RabbitMqUser: viper.GetString("RABBITMQ_USER"),
-		RabbitMqPass: viper.GetString("RABBITMQ_PASS"),
-		RedisHost:    viper.GetString("REDIS_HOST"),
-		RedisPort:    viper.GetInt("REDIS_PORT"),
-		RedisPass:    viper.GetString("REDIS_PASS"),
-		RedisDB:      viper.GetInt("REDIS_DB"),
-		Versioning:   viper.GetBool("VERSIONING"),
-		ChannelName:  viper.GetString("CHANNEL_NAME"),
-		Scheduler:    viper.GetString("SCHEDULER"),
+		NodeType:              model.Node(viper.GetString("TYPE")),
+		Tags:                  viper.GetStringSlice("TAGS"),
+		Address:               viper.GetString("ADDRESS"),
+		HeartbeatInterval:     viper.GetInt("HEARTBEAT_INTERVAL"),
+		HeartbeatTimeout:      viper.GetInt("HEARTBEAT_TIMEOUT"),
+		Path:                  appPath,
+		Mode:                  mode,
+		LibPath:               path.Join(appPath, "files"),
+		Port:                  viper.GetInt("PORT"),
+		SecretKey:             viper.GetString("SECRET_KEY"),
+		DB:                    model.DB(viper.GetString("DB")),
+		DBPath:                dbPath,
+		DBName:                viper.GetString("DB_NAME"),
+		DBHost:                viper.GetString("DB_HOST"),
+		DBPort:                viper.GetInt("DB_PORT"),
+		DBUser:                viper.GetString("DB_USER"),
+		DBPass:                viper.GetString("DB_PASS"),
+		DBSsl:                 viper.GetString("DB_SSL"),
+		RabbitMqHost:          viper.GetString("RABBITMQ_HOST"),
+		RabbitMqPort:          viper.GetInt("RABBITMQ_PORT"),
+		RabbitMqUser:          viper.GetString("RABBITMQ_USER"),
+		RabbitMqPass:          viper.GetString("RABBITMQ_PASS"),
+		RabbitMqPrefetch:      viper.GetInt("RABBITMQ_PREFETCH"),
+		RabbitMqDeliveryLimit: viper.GetInt("RABBITMQ_DELIVERY_LIMIT"),
+		RedisHost:             viper.GetString("REDIS_HOST"),
+		RedisPort:             viper.GetInt("REDIS_PORT"),
+		RedisPass:             viper.GetString("REDIS_PASS"),
+		RedisDB:               viper.GetInt("REDIS_DB"),
+		RedisStreamMaxLen:     viper.GetInt("REDIS_STREAM_MAXLEN"),
+		Versioning:            viper.GetBool("VERSIONING"),
+		VersionKeep:           viper.GetInt("VERSIONING_KEEP"),
+		Channel:               model.Channel(viper.GetString("CHANNEL")),
+		ChannelName:           viper.GetString("CHANNEL_NAME"),
+		ChannelSecret:         viper.GetString("CHANNEL_SECRET"),
+		MessageMaxAge:         viper.GetInt("MESSAGE_MAX_AGE"),
+		Scheduler:             viper.GetString("SCHEDULER"),
+		JobShell:              viper.GetString("JOB_SHELL"),
+		JobTimeout:            viper.GetInt("JOB_TIMEOUT"),
+		JobEnv:                viper.GetStringSlice("JOB_ENV"),
+		JobGrace:              viper.GetInt("JOB_GRACE_PERIOD"),
+		UploadExpire:          viper.GetInt("UPLOAD_EXPIRE"),
+		AllowedRoots:          viper.GetStringSlice("ALLOWED_ROOTS"),
 	}
 
 	if newAPI != nil {
@@ -161,6 +183,7 @@ func NewSuite() *Suite {
 	ch := make(chan bool)
 	go genNode(ch, newApp)
 	<-ch
+	newApp.Receive()
 
 	newAPI = NewAPI(newApp)
 
@@ -170,33 +193,10 @@ func NewSuite() *Suite {
 func genNode(ch chan bool, app *cmn.App) {
 	app.Logger.LogInfo("Generating node information")
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		panic(err)
-	}
-
-	hostname = fmt.Sprintf("node_%s@%s", string(app.Mode), hostname)
-	node := model2.NewNode()
-	res := app.Database.QueryRowWithModel(fmt.Sprintf(`SELECT * FROM %s `+
-		`WHERE code = $1`+
-		`ORDER BY id DESC LIMIT 1`,
-		node.TableName()),
-		node,
-		hostname)
-
-	app.Config.NodeName = hostname
-
-	if res.Error != nil {
-		node.Name = hostname
-		node.Code = hostname
-		err := app.Database.Insert(new(model2.Node), node, "id", "inserted_at")
-		if err != nil {
-			panic(errors.New("node information could not be created on the database, " + err.Error()))
-		}
+	if _, err := cmn.RegisterNode(app); err != nil {
+		panic(errors.New("node information could not be created on the database, " + err.Error()))
 	}
 
-	app.Node = node
-
 	app.Logger.LogInfo("Node information was created")
 
 	time.AfterFunc(time.Millisecond*100, func() {
@@ -17,8 +17,11 @@
 package api
 
 import (
+	"github.com/streetbyters/agente/cmn"
 	"github.com/streetbyters/agente/model"
+	"github.com/streetbyters/agente/utils"
 	"github.com/valyala/fasthttp"
+	"mime/multipart"
 	"os"
 	"path/filepath"
 )
@@ -29,11 +32,18 @@ type UploadController struct {
 	*API
 }
 
-// DirIndex directory list in lib path
+// DirIndex directory list in lib path except the reserved dirs
 func (c UploadController) DirIndex(ctx *fasthttp.RequestCtx) {
 	var dirs []model.Dir
 	i := 0
+	reserved := cmn.ReservedDirs(c.App)
 	filepath.Walk(c.App.Config.LibPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ok, _ := utils.InArray(path, reserved); ok {
+			return filepath.SkipDir
+		}
 		if info.IsDir() && i != 0 {
 			dirs = append(dirs, model.Dir{
 				Path:    path,
@@ -53,7 +63,10 @@ func (c UploadController) DirIndex(ctx *fasthttp.RequestCtx) {
 	}, fasthttp.StatusOK)
 }
 
-// Create file upload method
+// Create file upload method. Dir is resolved in lib path or allowed roots.
+// Uploaded file is stored by its sha256 checksum in lib path and the given
+// dir is linked to the stored blob. Upload is
+// removed after expiry unless a file or job references it.
 func (c UploadController) Create(ctx *fasthttp.RequestCtx) {
 	errs := make(map[string]string)
 	file, err := ctx.FormFile("file")
@@ -75,7 +88,17 @@ func (c UploadController) Create(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	err = fasthttp.SaveMultipartFile(file, filepath.Join(string(dir), file.Filename))
+	path, err := cmn.ResolvePath(c.App, string(dir), file.Filename)
+	if err != nil {
+		errs["dir"] = "is not allowed"
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	blob, err := c.store(file, path)
 	if err != nil {
 		c.JSONResponse(ctx, model.ResponseError{
 			Errors: nil,
@@ -84,13 +107,41 @@ func (c UploadController) Create(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	// TODO: If the uploaded file is not used within 5 minutes, it needs to be deleted.
+	upload, err := cmn.TrackUpload(c.App, blob, path, c.Auth.ID)
+	if err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
 
-	resp := make(map[string]string)
-	resp["dir"] = string(dir)
+	resp := make(map[string]interface{})
+	resp["id"] = upload.ID
+	resp["expires_at"] = upload.ExpiresAt
+	resp["dir"] = upload.Dir
 	resp["filename"] = file.Filename
+	resp["checksum"] = blob.Checksum
+	resp["size"] = blob.Size
+	resp["mime"] = blob.Mime
 
 	c.JSONResponse(ctx, model.ResponseSuccessOne{
 		Data: resp,
 	}, fasthttp.StatusCreated)
 }
+
+// store write uploaded file to the blob store and link path to the blob
+func (c UploadController) store(file *multipart.FileHeader, path string) (*cmn.Blob, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	blob, err := cmn.StoreBlob(c.App, src, file.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return blob, cmn.LinkBlob(c.App, blob.Checksum, path)
+}
@@ -1,9 +1,15 @@
 package api
 
 import (
+	"fmt"
+	"github.com/streetbyters/agente/cmn"
+	"github.com/streetbyters/agente/model"
 	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 type UploadControllerTest struct {
@@ -38,6 +44,17 @@ func (s UploadControllerTest) Test_PostUploadFile() {
 	data, _ := response.Success.Data.(map[string]interface{})
 	s.Equal(data["dir"], body["dir"].(string))
 	s.Equal(data["filename"], "agente.png")
+	s.Len(data["checksum"], 64)
+	s.Greater(data["size"], float64(0))
+	s.Equal(data["mime"], "image/png")
+	s.FileExists(filepath.Join(body["dir"].(string), "agente.png"))
+	s.Greater(data["id"], float64(0))
+	s.NotNil(data["expires_at"])
+
+	var state string
+	err := s.API.App.Database.DB.Get(&state, "SELECT state FROM ra_uploads WHERE id = $1", data["id"])
+	s.Nil(err)
+	s.Equal(state, string(model.UploadPending))
 
 	defaultLogger.LogInfo("Post upload file")
 }
@@ -69,18 +86,98 @@ func (s UploadControllerTest) Test_Should_422Err_PostUploadFileIfDirIsNil() {
 	defaultLogger.LogInfo("Should be 422 error post upload file if dir is nil")
 }
 
-func (s UploadControllerTest) Test_Should_500Error_PostUploadFileIfDirPermissionError() {
+func (s UploadControllerTest) Test_Should_422Err_PostUploadFileIfDirIsNotAllowed() {
+	file1 := filepath.Join(s.API.App.Config.Path, "files", "tests", "agente.png")
+
+	for _, dir := range []string{
+		"/root",
+		"/etc",
+		"../../",
+		"tests/../../../etc",
+		filepath.Join(s.API.App.Config.LibPath, "..", ".."),
+	} {
+		body := make(map[string]interface{})
+		body["file"] = file1
+		body["dir"] = dir
+
+		response := s.File(Post, "/api/v1/upload", body, "file")
+
+		s.Equal(response.Status, fasthttp.StatusUnprocessableEntity, dir)
+		s.Equal(response.Error.Errors.(map[string]interface{})["dir"], "is not allowed")
+	}
+
+	defaultLogger.LogInfo("Should be 422 error post upload file if dir is not allowed")
+}
+
+func (s UploadControllerTest) Test_PostUploadFileToRelativeDir() {
 	file1 := filepath.Join(s.API.App.Config.Path, "files", "tests", "agente.png")
 
 	body := make(map[string]interface{})
 	body["file"] = file1
-	body["dir"] = "/root"
+	body["dir"] = "tests/upload"
 
 	response := s.File(Post, "/api/v1/upload", body, "file")
 
-	s.Equal(response.Status, fasthttp.StatusInternalServerError)
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+	s.Equal(data["dir"], filepath.Join(s.API.App.Config.LibPath, "tests", "upload"))
 
-	defaultLogger.LogInfo("Post upload file")
+	defaultLogger.LogInfo("Post upload file to a dir relative to lib path")
+}
+
+func (s UploadControllerTest) upload(dir string, name string, content string) map[string]interface{} {
+	path := filepath.Join(dir, name)
+	s.Nil(ioutil.WriteFile(path, []byte(content), 0644))
+
+	body := make(map[string]interface{})
+	body["file"] = path
+	body["dir"] = filepath.Join(dir, "upload")
+
+	response := s.File(Post, "/api/v1/upload", body, "file")
+	s.Equal(response.Status, fasthttp.StatusCreated)
+	data, _ := response.Success.Data.(map[string]interface{})
+
+	return data
+}
+
+func (s UploadControllerTest) Test_SweepStaleUploads() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	content := fmt.Sprintf("stale %d", time.Now().UnixNano())
+	stale := s.upload(dir, "stale.txt", content)
+	kept := s.upload(dir, "kept.txt", fmt.Sprintf("kept %d", time.Now().UnixNano()))
+
+	file := make(map[string]interface{})
+	file["dir"] = kept["dir"]
+	file["file"] = "kept.txt"
+	response := s.JSON(Post, "/api/v1/file", file)
+	s.Equal(response.Status, fasthttp.StatusCreated)
+
+	_, err = s.API.App.Database.DB.Exec("UPDATE ra_uploads SET expires_at = $1 WHERE id IN ($2, $3)",
+		time.Now().UTC().Add(-time.Hour), stale["id"], kept["id"])
+	s.Nil(err)
+
+	sweep, err := cmn.SweepUploads(s.API.App, time.Now().UTC())
+	s.Nil(err)
+	s.Equal(sweep.Uploads, 1)
+	s.Equal(sweep.Files, 2)
+	s.Equal(sweep.Bytes, int64(len(content)))
+
+	s.False(cmn.BlobExists(s.API.App, stale["checksum"].(string)))
+	_, err = os.Stat(filepath.Join(dir, "upload", "stale.txt"))
+	s.True(os.IsNotExist(err))
+
+	s.True(cmn.BlobExists(s.API.App, kept["checksum"].(string)))
+	s.FileExists(filepath.Join(dir, "upload", "kept.txt"))
+
+	var state string
+	err = s.API.App.Database.DB.Get(&state, "SELECT state FROM ra_uploads WHERE id = $1", kept["id"])
+	s.Nil(err)
+	s.Equal(state, string(model.UploadPromoted))
+
+	defaultLogger.LogInfo("Sweep stale uploads")
 }
 
 func (s UploadControllerTest) TearDownSuite() {
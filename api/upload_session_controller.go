@@ -0,0 +1,317 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/fate-lovely/phi"
+	"github.com/streetbyters/agente/cmn"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"github.com/valyala/fasthttp"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TusVersion supported tus resumable upload protocol version
+	TusVersion = "1.0.0"
+	// TusExtensions supported tus resumable upload protocol extensions
+	TusExtensions = "creation,termination"
+)
+
+// checksumRegexp hex encoded sha256 checksum
+var checksumRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// UploadSessionController resumable upload api controller. Sessions are
+// compatible with the core, creation and termination tus protocol.
+type UploadSessionController struct {
+	Controller
+	*API
+}
+
+// Create upload session with Upload-Length header. Filename, dir and the
+// optional sha256 checksum of the content are given in Upload-Metadata
+// header as base64 encoded values.
+func (c UploadSessionController) Create(ctx *fasthttp.RequestCtx) {
+	tusHeaders(ctx)
+
+	errs := make(map[string]string)
+	length, err := strconv.ParseInt(string(ctx.Request.Header.Peek("Upload-Length")), 10, 64)
+	if err != nil || length < 0 {
+		errs["upload_length"] = "is not valid"
+	}
+
+	metadata := uploadMetadata(string(ctx.Request.Header.Peek("Upload-Metadata")))
+	if metadata["filename"] == "" {
+		errs["filename"] = "is not nil"
+	}
+	if metadata["dir"] == "" {
+		errs["dir"] = "is not nil"
+	}
+	if checksum := metadata["checksum"]; checksum != "" && !checksumRegexp.MatchString(checksum) {
+		errs["checksum"] = "is not valid"
+	}
+
+	path, err := cmn.ResolvePath(c.App, metadata["dir"], metadata["filename"])
+	if err != nil && errs["dir"] == "" && errs["filename"] == "" {
+		errs["dir"] = "is not allowed"
+	}
+
+	if len(errs) > 0 {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	session := model2.NewUploadSession(c.App.Node.ID)
+	session.SourceUserID.SetValid(c.Auth.ID)
+	session.Dir = filepath.Dir(path)
+	session.File = metadata["filename"]
+	session.Length = length
+	if metadata["checksum"] != "" {
+		session.Checksum.SetValid(metadata["checksum"])
+	}
+	session.ExpiresAt = time.Now().UTC().Add(cmn.UploadSessionExpire)
+
+	if err := c.App.Database.Insert(new(model2.UploadSession), session, "id", "inserted_at", "updated_at"); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if length == 0 {
+		if _, err := cmn.FinishUpload(c.App, session); err != nil {
+			c.finishError(ctx, err)
+			return
+		}
+	}
+
+	ctx.Response.Header.Set("Location", fmt.Sprintf("/api/v1/upload/session/%d", session.ID))
+	ctx.Response.Header.Set("Upload-Offset", "0")
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model2.UploadProgress{UploadSession: session},
+	}, fasthttp.StatusCreated)
+}
+
+// Show upload session with the length of received content
+func (c UploadSessionController) Show(ctx *fasthttp.RequestCtx) {
+	session := c.session(ctx)
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model2.UploadProgress{UploadSession: session, Offset: cmn.UploadOffset(c.App, session)},
+	}, fasthttp.StatusOK)
+}
+
+// Head upload session progress in Upload-Offset and Upload-Length headers
+func (c UploadSessionController) Head(ctx *fasthttp.RequestCtx) {
+	session := c.session(ctx)
+
+	tusHeaders(ctx)
+	ctx.Response.Header.Set("Upload-Offset", strconv.FormatInt(cmn.UploadOffset(c.App, session), 10))
+	ctx.Response.Header.Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// Patch write chunk in request body at Upload-Offset header. PATCH requests
+// must have application/offset+octet-stream content type as in the tus
+// protocol, PUT requests may have any content type. Session is finalized
+// with checksum verification when its whole content is received.
+func (c UploadSessionController) Patch(ctx *fasthttp.RequestCtx) {
+	session := c.session(ctx)
+	tusHeaders(ctx)
+
+	if ctx.IsPatch() && string(ctx.Request.Header.ContentType()) != "application/offset+octet-stream" {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnsupportedMediaType),
+		}, fasthttp.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(string(ctx.Request.Header.Peek("Upload-Offset")), 10, 64)
+	if err != nil || offset < 0 {
+		errs := make(map[string]string)
+		errs["upload_offset"] = "is not valid"
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	offset, err = cmn.WriteChunk(c.App, session, offset, bytes.NewReader(ctx.PostBody()))
+	ctx.Response.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	switch err {
+	case nil:
+		break
+	case cmn.ErrUploadSessionNotFound:
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusNotFound)
+		return
+	case cmn.ErrUploadOffset:
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusConflict)
+		return
+	case cmn.ErrUploadLength:
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusRequestEntityTooLarge)
+		return
+	default:
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if offset == session.Length && !session.Completed() {
+		if _, err := cmn.FinishUpload(c.App, session); err != nil {
+			ctx.Response.Header.Set("Upload-Offset", strconv.FormatInt(cmn.UploadOffset(c.App, session), 10))
+			c.finishError(ctx, err)
+			return
+		}
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// Finish finalize upload session whose whole content is received. Sessions
+// are finalized with their last chunk, so this only retries a failed one.
+func (c UploadSessionController) Finish(ctx *fasthttp.RequestCtx) {
+	session := c.session(ctx)
+	tusHeaders(ctx)
+
+	if !session.Completed() {
+		if cmn.UploadOffset(c.App, session) != session.Length {
+			c.JSONResponse(ctx, model.ResponseError{
+				Errors: nil,
+				Detail: "upload is not complete",
+			}, fasthttp.StatusConflict)
+			return
+		}
+
+		if _, err := cmn.FinishUpload(c.App, session); err != nil {
+			c.finishError(ctx, err)
+			return
+		}
+	}
+
+	c.JSONResponse(ctx, model.ResponseSuccessOne{
+		Data: model2.UploadProgress{UploadSession: session, Offset: session.Length},
+	}, fasthttp.StatusOK)
+}
+
+// Delete upload session and its received content
+func (c UploadSessionController) Delete(ctx *fasthttp.RequestCtx) {
+	session := c.session(ctx)
+
+	if err := cmn.RemoveUploadSession(c.App, session); err != nil {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusNotFound),
+		}, fasthttp.StatusNotFound)
+		return
+	}
+
+	tusHeaders(ctx)
+	c.JSONResponse(ctx, nil, fasthttp.StatusNoContent)
+}
+
+// session upload session of the authenticated user on this node
+func (c UploadSessionController) session(ctx *fasthttp.RequestCtx) *model2.UploadSession {
+	session := model2.NewUploadSession(c.App.Node.ID)
+	c.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s "+
+		"WHERE id = $1 AND node_id = $2 AND source_user_id = $3", session.TableName()),
+		session,
+		phi.URLParam(ctx, "sessionID"),
+		c.App.Node.ID,
+		c.Auth.ID).Force()
+
+	return session
+}
+
+// finishError respond error of finalizing upload session
+func (c UploadSessionController) finishError(ctx *fasthttp.RequestCtx, err error) {
+	if err == cmn.ErrUploadSessionNotFound {
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: nil,
+			Detail: err.Error(),
+		}, fasthttp.StatusNotFound)
+		return
+	}
+
+	if err == cmn.ErrChecksumMismatch {
+		errs := make(map[string]string)
+		errs["checksum"] = "does not match"
+		c.JSONResponse(ctx, model.ResponseError{
+			Errors: errs,
+			Detail: fasthttp.StatusMessage(fasthttp.StatusUnprocessableEntity),
+		}, fasthttp.StatusUnprocessableEntity)
+		return
+	}
+
+	c.JSONResponse(ctx, model.ResponseError{
+		Errors: nil,
+		Detail: err.Error(),
+	}, fasthttp.StatusInternalServerError)
+}
+
+// tusHeaders set tus protocol headers of upload session responses
+func tusHeaders(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Tus-Resumable", TusVersion)
+	ctx.Response.Header.Set("Access-Control-Expose-Headers", "Location,Upload-Offset,Upload-Length,Tus-Resumable")
+}
+
+// uploadMetadata parse comma separated key and base64 encoded value pairs
+// of Upload-Metadata header
+func uploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var value []byte
+		if len(fields) > 1 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				continue
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+
+	return metadata
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/streetbyters/agente/cmn"
+	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type UploadSessionControllerTest struct {
+	*Suite
+}
+
+func (s UploadSessionControllerTest) SetupSuite() {
+	SetupSuite(s.Suite)
+	UserAuth(s.Suite)
+}
+
+func (s UploadSessionControllerTest) Test_ResumableUpload() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	content := fmt.Sprintf("resumable %d", time.Now().UnixNano())
+	sum := sha256.Sum256([]byte(content))
+
+	resp := s.tus(Post, "/api/v1/upload/session", map[string]string{
+		"Upload-Length": fmt.Sprint(len(content)),
+		"Upload-Metadata": s.metadata(map[string]string{
+			"filename": "resumable.txt",
+			"dir":      dir,
+			"checksum": hex.EncodeToString(sum[:]),
+		}),
+	}, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusCreated)
+	s.Equal(string(resp.Header.Peek("Tus-Resumable")), TusVersion)
+	location := string(resp.Header.Peek("Location"))
+	s.True(strings.HasPrefix(location, "/api/v1/upload/session/"))
+
+	resp = s.tus(Patch, location, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, content[:5])
+	s.Equal(resp.StatusCode(), fasthttp.StatusNoContent)
+	s.Equal(string(resp.Header.Peek("Upload-Offset")), "5")
+
+	resp = s.tus(Patch, location, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, content[:5])
+	s.Equal(resp.StatusCode(), fasthttp.StatusConflict)
+
+	resp = s.tus(Head, location, nil, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusOK)
+	s.Equal(string(resp.Header.Peek("Upload-Offset")), "5")
+	s.Equal(string(resp.Header.Peek("Upload-Length")), fmt.Sprint(len(content)))
+
+	resp = s.tus(Patch, location, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "5",
+	}, content[5:])
+	s.Equal(resp.StatusCode(), fasthttp.StatusNoContent)
+	s.Equal(string(resp.Header.Peek("Upload-Offset")), fmt.Sprint(len(content)))
+
+	received, err := ioutil.ReadFile(filepath.Join(dir, "resumable.txt"))
+	s.Nil(err)
+	s.Equal(string(received), content)
+	s.True(cmn.BlobExists(s.API.App, hex.EncodeToString(sum[:])))
+
+	response := s.JSON(Get, location, nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+	data, _ := response.Success.Data.(map[string]interface{})
+	s.Equal(data["offset"], float64(len(content)))
+	s.NotNil(data["upload_id"])
+
+	response = s.JSON(Post, location+"/finish", nil)
+	s.Equal(response.Status, fasthttp.StatusOK)
+
+	defaultLogger.LogInfo("Resumable upload with tus protocol")
+}
+
+func (s UploadSessionControllerTest) Test_Should_422Err_ResumableUploadIfChecksumDoesNotMatch() {
+	dir, err := ioutil.TempDir("", "agente")
+	s.Nil(err)
+	defer os.RemoveAll(dir)
+
+	resp := s.tus(Post, "/api/v1/upload/session", map[string]string{
+		"Upload-Length": "7",
+		"Upload-Metadata": s.metadata(map[string]string{
+			"filename": "mismatch.txt",
+			"dir":      dir,
+			"checksum": strings.Repeat("0", 64),
+		}),
+	}, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusCreated)
+	location := string(resp.Header.Peek("Location"))
+
+	resp = s.tus(Put, location, map[string]string{"Upload-Offset": "0"}, "agente!")
+	s.Equal(resp.StatusCode(), fasthttp.StatusUnprocessableEntity)
+	s.Equal(string(resp.Header.Peek("Upload-Offset")), "0")
+	_, err = os.Stat(filepath.Join(dir, "mismatch.txt"))
+	s.True(os.IsNotExist(err))
+
+	resp = s.tus(Delete, location, nil, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusNoContent)
+	resp = s.tus(Head, location, nil, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusNotFound)
+
+	defaultLogger.LogInfo("Should be 422 error resumable upload if checksum does not match")
+}
+
+func (s UploadSessionControllerTest) Test_Should_422Err_CreateUploadSessionIfDirIsNotAllowed() {
+	resp := s.tus(Post, "/api/v1/upload/session", map[string]string{
+		"Upload-Length": "7",
+		"Upload-Metadata": s.metadata(map[string]string{
+			"filename": "agente.txt",
+			"dir":      "/root",
+		}),
+	}, "")
+	s.Equal(resp.StatusCode(), fasthttp.StatusUnprocessableEntity)
+
+	var body map[string]interface{}
+	s.Nil(json.Unmarshal(resp.Body(), &body))
+	s.Equal(body["errors"], map[string]interface{}{"dir": "is not allowed"})
+
+	defaultLogger.LogInfo("Should be 422 error create upload session if dir is not allowed")
+}
+
+func (s UploadSessionControllerTest) tus(method Method, uri string, headers map[string]string, body string) *fasthttp.Response {
+	req := fasthttp.AcquireRequest()
+	req.Header.SetHost(s.API.Router.Addr)
+	req.Header.SetRequestURI(uri)
+	req.Header.SetMethod(string(method))
+	req.Header.Set("Authorization", "Bearer "+s.Auth.Token)
+	req.Header.Set("Tus-Resumable", TusVersion)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.SetBodyString(body)
+	resp := fasthttp.AcquireResponse()
+	s.Nil(s.serveAPI(s.API.Router.Handler.ServeFastHTTP, req, resp))
+
+	return resp
+}
+
+func (s UploadSessionControllerTest) metadata(values map[string]string) string {
+	var pairs []string
+	for key, value := range values {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (s UploadSessionControllerTest) TearDownSuite() {
+	TearDownSuite(s.Suite)
+}
+
+func Test_UploadSessionController(t *testing.T) {
+	s := UploadSessionControllerTest{NewSuite()}
+	Run(t, s)
+}
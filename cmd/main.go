@@ -19,12 +19,10 @@ package main
 import (
 	"errors"
 	"flag"
-	"fmt"
 	"github.com/spf13/viper"
 	"github.com/streetbyters/agente/api"
 	"github.com/streetbyters/agente/cmn"
 	"github.com/streetbyters/agente/database"
-	model2 "github.com/streetbyters/agente/database/model"
 	"github.com/streetbyters/agente/model"
 	"github.com/streetbyters/agente/utils"
 	"os"
@@ -47,7 +45,7 @@ var migrate bool
 var reset bool
 
 func main() {
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 
 	var mode model.MODE
@@ -92,30 +90,48 @@ func main() {
 	cmn.FailOnError(logger, err)
 
 	config := &model.Config{
-		NodeType:     model.Node(viper.GetString("TYPE")),
-		Path:         appPath,
-		LibPath:      libPath,
-		Port:         viper.GetInt("PORT"),
-		SecretKey:    viper.GetString("SECRET_KEY"),
-		DB:           model.DB(viper.GetString("DB")),
-		DBPath:       dbPath,
-		DBName:       viper.GetString("DB_NAME"),
-		DBHost:       viper.GetString("DB_HOST"),
-		DBPort:       viper.GetInt("DB_PORT"),
-		DBUser:       viper.GetString("DB_USER"),
-		DBPass:       viper.GetString("DB_PASS"),
-		DBSsl:        viper.GetString("DB_SSL"),
-		RabbitMqHost: viper.GetString("RABBITMQ_HOST"),
-		RabbitMqPort: viper.GetInt("RABBITMQ_PORT"),
-		RabbitMqUser: viper.GetString("RABBITMQ_USER"),
-		RabbitMqPass: viper.GetString("RABBITMQ_PASS"),
-		RedisHost:    viper.GetString("REDIS_HOST"),
-		RedisPort:    viper.GetInt("REDIS_PORT"),
-		RedisPass:    viper.GetString("REDIS_PASS"),
-		RedisDB:      viper.GetInt("REDIS_DB"),
-		Versioning:   viper.GetBool("VERSIONING"),
-		ChannelName:  viper.GetString("CHANNEL_NAME"),
-		Scheduler:    viper.GetString("SCHEDULER"),
+		NodeType:              model.Node(viper.GetString("TYPE")),
+		Tags:                  viper.GetStringSlice("TAGS"),
+		Address:               viper.GetString("ADDRESS"),
+		HeartbeatInterval:     viper.GetInt("HEARTBEAT_INTERVAL"),
+		HeartbeatTimeout:      viper.GetInt("HEARTBEAT_TIMEOUT"),
+		Path:                  appPath,
+		Mode:                  mode,
+		LibPath:               libPath,
+		Port:                  viper.GetInt("PORT"),
+		SecretKey:             viper.GetString("SECRET_KEY"),
+		DB:                    model.DB(viper.GetString("DB")),
+		DBPath:                dbPath,
+		DBName:                viper.GetString("DB_NAME"),
+		DBHost:                viper.GetString("DB_HOST"),
+		DBPort:                viper.GetInt("DB_PORT"),
+		DBUser:                viper.GetString("DB_USER"),
+		DBPass:                viper.GetString("DB_PASS"),
+		DBSsl:                 viper.GetString("DB_SSL"),
+		RabbitMqHost:          viper.GetString("RABBITMQ_HOST"),
+		RabbitMqPort:          viper.GetInt("RABBITMQ_PORT"),
+		RabbitMqUser:          viper.GetString("RABBITMQ_USER"),
+		RabbitMqPass:          viper.GetString("RABBITMQ_PASS"),
+		RabbitMqPrefetch:      viper.GetInt("RABBITMQ_PREFETCH"),
+		RabbitMqDeliveryLimit: viper.GetInt("RABBITMQ_DELIVERY_LIMIT"),
+		RedisHost:             viper.GetString("REDIS_HOST"),
+		RedisPort:             viper.GetInt("REDIS_PORT"),
+		RedisPass:             viper.GetString("REDIS_PASS"),
+		RedisDB:               viper.GetInt("REDIS_DB"),
+		RedisStreamMaxLen:     viper.GetInt("REDIS_STREAM_MAXLEN"),
+		Versioning:            viper.GetBool("VERSIONING"),
+		VersionKeep:           viper.GetInt("VERSIONING_KEEP"),
+		Channel:               model.Channel(viper.GetString("CHANNEL")),
+		ChannelName:           viper.GetString("CHANNEL_NAME"),
+		ChannelSecret:         viper.GetString("CHANNEL_SECRET"),
+		MessageMaxAge:         viper.GetInt("MESSAGE_MAX_AGE"),
+		Scheduler:             viper.GetString("SCHEDULER"),
+		JobShell:              viper.GetString("JOB_SHELL"),
+		JobTimeout:            viper.GetInt("JOB_TIMEOUT"),
+		JobEnv:                viper.GetStringSlice("JOB_ENV"),
+		JobGrace:              viper.GetInt("JOB_GRACE_PERIOD"),
+		UploadExpire:          viper.GetInt("UPLOAD_EXPIRE"),
+		AllowedRoots:          viper.GetStringSlice("ALLOWED_ROOTS"),
 	}
 
 	if config.DB == "" {
@@ -129,12 +145,18 @@ func main() {
 		panic(errors.New("enter CHANNEL_NAME conf"))
 	}
 
-	if config.RedisHost == "" && config.RabbitMqHost == "" {
-		panic(errors.New("enter one of the redis or rabbitMQ configurations"))
+	if config.Channel != model.MemoryChannel && config.ChannelSecret == "" && config.SecretKey == "" {
+		panic(errors.New("enter CHANNEL_SECRET or SECRET_KEY conf"))
 	}
 
-	if config.RedisHost != "" && config.RabbitMqHost != "" {
-		panic(errors.New("you can only work on one queue(redis or rabbitMQ) system"))
+	if config.Channel == "" {
+		if config.RedisHost == "" && config.RabbitMqHost == "" {
+			panic(errors.New("enter CHANNEL conf or one of the redis or rabbitMQ configurations"))
+		}
+
+		if config.RedisHost != "" && config.RabbitMqHost != "" {
+			panic(errors.New("you can only work on one queue(redis or rabbitMQ) system"))
+		}
 	}
 
 	db, err := database.NewDB(config)
@@ -153,8 +175,13 @@ func main() {
 	}
 
 	genNode(newApp)
+	newApp.Receive()
 
 	newApp.Scheduler = cmn.NewScheduler(newApp)
+	if err := cmn.ScheduleUploadSweeper(newApp); err != nil {
+		logger.LogError(err, "upload sweeper could not be scheduled")
+	}
+	newApp.Monitor = cmn.NewNodeMonitor(newApp)
 
 	newAPI := api.NewAPI(newApp)
 	go func() {
@@ -163,37 +190,16 @@ func main() {
 	}()
 
 	<-newApp.Channel
+
+	newApp.Monitor.Stop()
 }
 
 func genNode(app *cmn.App) {
 	app.Logger.LogInfo("Generating node information")
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		panic(err)
+	if _, err := cmn.RegisterNode(app); err != nil {
+		panic(errors.New("node information could not be created on the database, " + err.Error()))
 	}
 
-	hostname = fmt.Sprintf("node_%s@%s", string(app.Mode), hostname)
-	node := model2.NewNode()
-	res := app.Database.QueryRowWithModel(fmt.Sprintf(`SELECT * FROM %s `+
-		`WHERE code = $1`+
-		`ORDER BY id DESC LIMIT 1`,
-		node.TableName()),
-		node,
-		hostname)
-
-	app.Config.NodeName = hostname
-
-	if res.Error != nil {
-		node.Name = hostname
-		node.Code = hostname
-		err := app.Database.Insert(new(model2.Node), node, "id", "inserted_at")
-		if err != nil {
-			panic(errors.New("node information could not be created on the database, " + err.Error()))
-		}
-	}
-
-	app.Node = node
-
 	app.Logger.LogInfo("Node information was created")
 }
@@ -17,25 +17,32 @@
 package cmn
 
 import (
+	"fmt"
 	"github.com/streetbyters/agente/database"
 	model2 "github.com/streetbyters/agente/database/model"
 	"github.com/streetbyters/agente/model"
 	"github.com/streetbyters/agente/utils"
 	"os"
+	"sync"
 )
 
 // App structure
 type App struct {
-	Database        *database.Database
-	Channel         chan os.Signal
-	Config          *model.Config
-	Logger          *utils.Logger
-	ChannelRabbitMq *ChannelRabbitMq
-	ChannelRedis    *ChannelRedis
-	Scheduler       *Scheduler
-	Mode            model.MODE
-	Job             *Job
-	Node            *model2.Node
+	Database   *database.Database
+	Channel    chan os.Signal
+	Config     *model.Config
+	Logger     *utils.Logger
+	Queue      ChannelInterface
+	Connection *Connection
+	Scheduler  *Scheduler
+	Monitor    *NodeMonitor
+	Mode       model.MODE
+	Job        *Job
+	Node       *model2.Node
+	Messages   *MessageCache
+	Signer     *MessageSigner
+	Worker     *JobWorker
+	tags       sync.RWMutex
 }
 
 // NewApp building new app
@@ -45,29 +52,55 @@ func NewApp(config *model.Config, logger *utils.Logger) *App {
 		Logger: logger,
 	}
 
-	if app.Config.RabbitMqHost != "" {
-		app.Config.RabbitMq = true
-		app.ChannelRabbitMq = NewRabbitMq(app)
-		app.ChannelRabbitMq.Start()
-		app.ChannelRabbitMq.Subscribe()
-		go app.ChannelRabbitMq.Receive()
+	if app.Config.NodeName == "" {
+		app.Config.NodeName = NodeName(app.Config.Mode)
 	}
 
-	if app.Config.RedisHost != "" {
-		app.Config.Redis = true
-		app.ChannelRedis = NewRedis(app)
-		app.ChannelRedis.Start()
-		app.ChannelRedis.Subscribe()
-		go app.ChannelRedis.Receive()
+	app.Job = NewJob(app)
+	app.Signer = NewMessageSigner(app)
+	app.Messages = NewMessageCache(app.Signer.MaxAge + model.MessageClockSkew)
+	if app.Config.LibPath != "" {
+		if err := app.Messages.Persist(MessageCachePath(app)); err != nil {
+			app.Logger.LogError(err, "received messages could not be persisted")
+		}
 	}
 
-	app.Job = NewJob(app)
+	app.Worker = NewJobWorker()
+	app.Queue = NewChannel(app)
+	app.Queue.Start()
+	app.Queue.Subscribe()
 
 	app.Logger.LogInfo("Started application")
 
 	return app
 }
 
+// Receive start the job worker and receiving channel messages. It should be
+// called once database and node of the app are set.
+func (a *App) Receive() {
+	go a.Worker.Run(a)
+	go a.Queue.Receive()
+}
+
+// Tags node tags messages are routed to this node by
+func (a *App) Tags() []string {
+	a.tags.RLock()
+	defer a.tags.RUnlock()
+
+	return a.Config.Tags
+}
+
+// SetTags replace node tags of this node and return previous tags
+func (a *App) SetTags(tags []string) []string {
+	a.tags.Lock()
+	defer a.tags.Unlock()
+
+	old := a.Config.Tags
+	a.Config.Tags = tags
+
+	return old
+}
+
 // FailOnError panic error with logger
 func FailOnError(logger *utils.Logger, err error) {
 	if err != nil {
@@ -75,3 +108,13 @@ func FailOnError(logger *utils.Logger, err error) {
 		panic(err)
 	}
 }
+
+// NodeName node code of the running host for the given mode
+func NodeName(mode model.MODE) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("node_%s@%s", string(mode), hostname)
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrChecksumMismatch stored content does not have the expected checksum
+var ErrChecksumMismatch = errors.New("checksum does not match")
+
+// Blob content addressed file stored in lib path
+type Blob struct {
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	Mime     string `json:"mime"`
+}
+
+// BlobDir directory of sha256 addressed blobs in lib path
+func BlobDir(app *App) string {
+	return filepath.Join(app.Config.LibPath, "blobs", "sha256")
+}
+
+// BlobPath path of the blob with given sha256 checksum
+func BlobPath(app *App, checksum string) string {
+	if len(checksum) < 2 {
+		return filepath.Join(BlobDir(app), checksum)
+	}
+	return filepath.Join(BlobDir(app), checksum[0:2], checksum)
+}
+
+// BlobExists blob with given sha256 checksum is stored
+func BlobExists(app *App, checksum string) bool {
+	if len(checksum) != sha256.Size*2 {
+		return false
+	}
+	info, err := os.Stat(BlobPath(app, checksum))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// OpenBlob information of the blob with given checksum. Mime type is
+// detected from the name or content.
+func OpenBlob(app *App, checksum string, name string) (*Blob, error) {
+	if !BlobExists(app, checksum) {
+		return nil, errors.New("blob does not exist: " + checksum)
+	}
+
+	f, err := os.Open(BlobPath(app, checksum))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	sniff := &sniffer{}
+	if _, err := io.CopyN(sniff, f, 512); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &Blob{
+		Checksum: checksum,
+		Size:     info.Size(),
+		Mime:     detectMime(name, sniff.data),
+	}, nil
+}
+
+// StoreBlob write content to the blob store. Content already stored is not
+// written twice. Mime type is detected from the name or content.
+func StoreBlob(app *App, r io.Reader, name string) (*Blob, error) {
+	return storeBlob(app, r, name, "")
+}
+
+// storeBlob write content to the blob store if its checksum matches the
+// expected one unless it is empty
+func storeBlob(app *App, r io.Reader, name string, expected string) (*Blob, error) {
+	if err := os.MkdirAll(BlobDir(app), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(BlobDir(app), ".blob-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	sniff := &sniffer{}
+	size, err := io.Copy(io.MultiWriter(tmp, h, sniff), r)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &Blob{
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+		Size:     size,
+		Mime:     detectMime(name, sniff.data),
+	}
+
+	if expected != "" && blob.Checksum != expected {
+		return nil, ErrChecksumMismatch
+	}
+
+	if BlobExists(app, blob.Checksum) {
+		return blob, nil
+	}
+
+	path := BlobPath(app, blob.Checksum)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+
+	return blob, os.Rename(tmp.Name(), path)
+}
+
+// LinkBlob map the logical path onto the blob with given checksum. Blob is
+// copied to the path instead of hard linked, so writes to the path can not
+// change the blob. Existing file at path is replaced.
+func LinkBlob(app *App, checksum string, path string) error {
+	if !BlobExists(app, checksum) {
+		return errors.New("blob does not exist: " + checksum)
+	}
+
+	dir, name := filepath.Split(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name())
+
+	if err := copyBlob(app, checksum, tmp.Name()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyBlob copy blob with given checksum to path
+func copyBlob(app *App, checksum string, path string) error {
+	src, err := os.Open(BlobPath(app, checksum))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+
+	return err
+}
+
+// detectMime mime type of the content with given name and leading bytes
+func detectMime(name string, data []byte) string {
+	if typ := mime.TypeByExtension(filepath.Ext(name)); typ != "" {
+		return typ
+	}
+	return http.DetectContentType(data)
+}
+
+// sniffer keep the leading bytes of written content for mime detection
+type sniffer struct {
+	data []byte
+}
+
+func (s *sniffer) Write(p []byte) (int, error) {
+	if n := 512 - len(s.data); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		s.data = append(s.data, p[:n]...)
+	}
+	return len(p), nil
+}
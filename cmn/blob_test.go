@@ -0,0 +1,99 @@
+package cmn
+
+import (
+	"bytes"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_StoreBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &App{Config: &model.Config{LibPath: dir}, Logger: logger}
+
+	blob, err := StoreBlob(app, bytes.NewBufferString("{\"name\": \"agente\"}"), "agente.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blob.Checksum) != 64 || blob.Size != 18 || blob.Mime != "application/json" {
+		t.Fatalf("unexpected blob: %+v", blob)
+	}
+	if !BlobExists(app, blob.Checksum) {
+		t.Fatal("blob should be stored")
+	}
+
+	again, err := StoreBlob(app, bytes.NewBufferString("{\"name\": \"agente\"}"), "")
+	if err != nil || again.Checksum != blob.Checksum || again.Mime != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected blob: %+v %v", again, err)
+	}
+
+	shards, _ := ioutil.ReadDir(BlobDir(app))
+	if len(shards) != 1 {
+		t.Fatalf("same content should be stored once: %d", len(shards))
+	}
+
+	opened, err := OpenBlob(app, blob.Checksum, "agente.json")
+	if err != nil || opened.Size != blob.Size || opened.Mime != blob.Mime {
+		t.Fatalf("unexpected blob: %+v %v", opened, err)
+	}
+	if _, err := OpenBlob(app, "invalid", ""); err == nil {
+		t.Fatal("missing blob should not be opened")
+	}
+}
+
+func Test_LinkBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &App{Config: &model.Config{LibPath: dir}, Logger: logger}
+
+	blob, err := StoreBlob(app, bytes.NewBufferString("release"), "release.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "releases", "release.tar.gz")
+	os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	ioutil.WriteFile(path, []byte("old"), 0644)
+
+	if err := LinkBlob(app, blob.Checksum, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkBlob(app, blob.Checksum, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "release" {
+		t.Fatalf("unexpected file content: %s %v", data, err)
+	}
+
+	info, _ := os.Stat(path)
+	blobInfo, _ := os.Stat(BlobPath(app, blob.Checksum))
+	if os.SameFile(info, blobInfo) {
+		t.Fatal("path should not share the blob file")
+	}
+
+	f, _ := os.OpenFile(path, os.O_WRONLY, 0644)
+	f.WriteString("changed")
+	f.Close()
+	if data, err := ioutil.ReadFile(BlobPath(app, blob.Checksum)); err != nil || string(data) != "release" {
+		t.Fatalf("blob should not be changed by writing the path: %s %v", data, err)
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Fatalf("temporary files should be removed: %d", len(files))
+	}
+
+	if err := LinkBlob(app, "invalid", path); err == nil {
+		t.Fatal("missing blob should not be linked")
+	}
+}
@@ -16,9 +16,149 @@
 
 package cmn
 
+import (
+	"errors"
+	"github.com/streetbyters/agente/model"
+	"github.com/streetbyters/agente/utils"
+)
+
 // ChannelInterface queuing structure interface
 type ChannelInterface interface {
 	Start()
 	Subscribe()
 	Receive()
+	Publish(message *model.ReceivedMessage) error
+}
+
+// ChannelRebinder channel binding node tags on the broker. Bindings of
+// removed tags are dropped and added tags are bound.
+type ChannelRebinder interface {
+	Rebind(old []string, tags []string) error
+}
+
+// Channels All defined queuing systems
+func Channels(app *App) ([]model.Channel, map[model.Channel]ChannelInterface) {
+	channels := make(map[model.Channel]ChannelInterface)
+
+	channels[model.RabbitMqChannel] = NewRabbitMq(app)
+	channels[model.RedisChannel] = NewRedis(app)
+	channels[model.RedisStreamChannel] = NewRedisStream(app)
+	channels[model.MemoryChannel] = NewMemory(app)
+
+	return []model.Channel{model.RabbitMqChannel, model.RedisChannel, model.RedisStreamChannel,
+		model.MemoryChannel}, channels
+}
+
+// NewChannel building configured queuing system. If CHANNEL is not set it is
+// chosen from rabbitMQ and redis configurations.
+func NewChannel(app *App) ChannelInterface {
+	if app.Config.Channel == "" {
+		if app.Config.RabbitMqHost != "" {
+			app.Config.Channel = model.RabbitMqChannel
+		} else if app.Config.RedisHost != "" {
+			app.Config.Channel = model.RedisChannel
+		}
+	}
+
+	names, channels := Channels(app)
+
+	if ok, _ := utils.InArray(app.Config.Channel, names); !ok {
+		panic(errors.New("undefined channel"))
+	}
+
+	app.Config.RabbitMq = app.Config.Channel == model.RabbitMqChannel
+	app.Config.Redis = app.Config.Channel == model.RedisChannel ||
+		app.Config.Channel == model.RedisStreamChannel
+
+	return channels[app.Config.Channel]
+}
+
+// JobQueueSize received job messages waiting for the job worker
+var JobQueueSize = 256
+
+// JobWorker run received job messages one by one in order. Channels hand
+// job messages over to the worker, so heartbeats and job replies are
+// handled while a job is running.
+type JobWorker struct {
+	tasks chan jobTask
+}
+
+// jobTask received job message and its acknowledgement
+type jobTask struct {
+	message *model.ReceivedMessage
+	done    func(*JobResult)
+}
+
+// NewJobWorker building job worker
+func NewJobWorker() *JobWorker {
+	return &JobWorker{tasks: make(chan jobTask, JobQueueSize)}
+}
+
+// Run received job messages of the app
+func (w *JobWorker) Run(app *App) {
+	for task := range w.tasks {
+		result := receive(app, task.message)
+		if task.done != nil {
+			task.done(result)
+		}
+	}
+}
+
+// dispatch handle received message and call done with its result. Job
+// messages are run by the job worker of the app, heartbeats, job replies
+// and invalid messages are handled at once.
+func dispatch(app *App, message *model.ReceivedMessage, done func(*JobResult)) {
+	if app.Worker != nil && message != nil && message.Heartbeat == nil && message.Reply == nil {
+		app.Worker.tasks <- jobTask{message: message, done: done}
+		return
+	}
+
+	result := receive(app, message)
+	if done != nil {
+		done(result)
+	}
+}
+
+// receive run received message if it targets this node and reply the job
+// result if the message asks for it. Job replies are collected into
+// rollouts and heartbeats into the node registry. Invalid and duplicated
+// messages are dropped, heartbeats are not kept to drop duplicates because
+// a repeated heartbeat is harmless. Failed messages can be delivered again.
+func receive(app *App, message *model.ReceivedMessage) *JobResult {
+	if message == nil {
+		app.Logger.LogInfo("Dropped invalid message")
+		return nil
+	}
+
+	if !message.Targets(app.Config.NodeName, app.Config.NodeType, app.Tags()) {
+		return nil
+	}
+
+	if message.Heartbeat != nil {
+		heartbeat(app, message)
+		return nil
+	}
+
+	if message.ID != "" && app.Messages != nil && app.Messages.Seen(message.ID) {
+		app.Logger.LogInfo("Dropped duplicated message: " + message.ID)
+		return nil
+	}
+
+	if message.Reply != nil {
+		collect(app, message)
+		return nil
+	}
+
+	var result *JobResult
+	if message.Distribution != nil {
+		result = distribute(app, message)
+	} else {
+		result = app.Job.Run(message)
+	}
+	if !result.Success() && message.ID != "" && app.Messages != nil {
+		app.Messages.Forget(message.ID)
+	}
+	reply(app, message, result)
+
+	return result
 }
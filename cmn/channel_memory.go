@@ -0,0 +1,70 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"errors"
+	"github.com/streetbyters/agente/model"
+)
+
+// ChannelMemoryBuffer number of messages buffered by in-process queuing
+const ChannelMemoryBuffer = 64
+
+// ChannelMemory in-process queuing structure. Messages are only delivered
+// to the running node so it is meant for tests and single node installs.
+// Messages never leave the process so they are not signed.
+type ChannelMemory struct {
+	ChannelInterface
+	App      *App
+	Messages chan *model.ReceivedMessage
+}
+
+// NewMemory building in-process queuing
+func NewMemory(app *App) *ChannelMemory {
+	useConnection(app)
+
+	return &ChannelMemory{App: app}
+}
+
+// Start in-process queue
+func (m *ChannelMemory) Start() {
+	m.Messages = make(chan *model.ReceivedMessage, ChannelMemoryBuffer)
+	m.App.Logger.LogInfo("Start in-process channel")
+	m.App.Connection.Set(model.Connected, nil)
+}
+
+// Subscribe in-process channel
+func (m *ChannelMemory) Subscribe() {
+}
+
+// Receive in-process channel
+func (m *ChannelMemory) Receive() {
+	for message := range m.Messages {
+		m.App.Logger.LogInfo("Receive in-process message: " + message.JobName)
+		dispatch(m.App, message, nil)
+	}
+}
+
+// Publish message to in-process channel
+func (m *ChannelMemory) Publish(message *model.ReceivedMessage) error {
+	select {
+	case m.Messages <- message:
+		return nil
+	default:
+		return errors.New("in-process channel is full")
+	}
+}
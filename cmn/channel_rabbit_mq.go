@@ -17,48 +17,133 @@
 package cmn
 
 import (
+	"errors"
 	"github.com/streadway/amqp"
 	"github.com/streetbyters/agente/model"
 	"net/url"
 	"strconv"
+	"sync"
 )
 
+// DefaultRabbitMqPrefetch unacknowledged messages delivered to a node if
+// RABBITMQ_PREFETCH is not set
+const DefaultRabbitMqPrefetch = 1
+
+// DefaultRabbitMqDeliveryLimit deliveries of a failing message before it is
+// dead-lettered if RABBITMQ_DELIVERY_LIMIT is not set
+const DefaultRabbitMqDeliveryLimit = 5
+
 // ChannelRabbitMq queuing structure
 type ChannelRabbitMq struct {
 	ChannelInterface
 	App     *App
 	Conn    *amqp.Connection
 	Channel *amqp.Channel
+	mutex   sync.RWMutex
 }
 
 // NewRabbitMq building rabbitMQ queuing
 func NewRabbitMq(app *App) *ChannelRabbitMq {
+	useConnection(app)
+
 	return &ChannelRabbitMq{App: app}
 }
 
-// Start RabbitMQ Conn
+// Start RabbitMQ Conn. If the broker is not reachable the connection is
+// retried in Receive.
 func (r *ChannelRabbitMq) Start() {
+	r.App.Logger.LogInfo("Start RabbitMQ Connection")
+
+	r.App.Connection.Set(model.Connecting, nil)
+	if err := r.dial(); err != nil {
+		r.App.Connection.Set(model.Disconnected, err)
+		return
+	}
+	r.App.Connection.Set(model.Connected, nil)
+}
+
+// dial open rabbitMQ connection and channel
+func (r *ChannelRabbitMq) dial() error {
 	uri := url.URL{
 		Scheme: "amqp",
 		User:   url.UserPassword(r.App.Config.RabbitMqUser, r.App.Config.RabbitMqPass),
 		Host:   r.App.Config.RabbitMqHost + ":" + strconv.Itoa(r.App.Config.RabbitMqPort),
 	}
 	conn, err := amqp.Dial(uri.String())
-	FailOnError(r.App.Logger, err)
+	if err != nil {
+		return err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
 
+	r.mutex.Lock()
 	r.Conn = conn
-	r.App.Logger.LogInfo("Start RabbitMQ Connection")
+	r.Channel = channel
+	r.mutex.Unlock()
+
+	return nil
+}
+
+// close rabbitMQ channel and connection
+func (r *ChannelRabbitMq) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Channel != nil {
+		r.Channel.Close()
+	}
+	if r.Conn != nil {
+		r.Conn.Close()
+	}
+	r.Channel = nil
+	r.Conn = nil
 }
 
 // Subscribe rabbitMQ channel
 func (r *ChannelRabbitMq) Subscribe() {
-	channel, err := r.Conn.Channel()
-	FailOnError(r.App.Logger, err)
+	if r.Channel == nil {
+		return
+	}
 
-	r.Channel = channel
+	if err := r.declare(); err != nil {
+		r.App.Logger.LogError(err, "rabbitMQ error channel declare")
+	}
+}
+
+// declare target, control and dead letter exchanges and dead letter queue
+func (r *ChannelRabbitMq) declare() error {
+	err := r.Channel.ExchangeDeclare(
+		r.Exchange(),
+		"headers",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
 
 	err = r.Channel.ExchangeDeclare(
-		r.App.Config.ChannelName,
+		r.ControlExchange(),
+		"headers",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = r.Channel.ExchangeDeclare(
+		r.DeadLetterExchange(),
 		"fanout",
 		true,
 		false,
@@ -67,57 +152,287 @@ func (r *ChannelRabbitMq) Subscribe() {
 		nil,
 	)
 	if err != nil {
-		r.App.Logger.LogError(err, "rabbitMQ error channel exchange declare")
+		return err
 	}
+
+	_, err = r.Channel.QueueDeclare(
+		r.DeadLetterExchange(),
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.Channel.QueueBind(r.DeadLetterExchange(), "", r.DeadLetterExchange(), false, nil)
 }
 
-// Receive consume rabbitMQ channel
+// Receive consume durable node queue and control queue of rabbitMQ channel.
+// Heartbeats and job replies are consumed from the control queue, so they
+// are not delivered after unacknowledged jobs. Messages are
+// acknowledged after the job is finished and requeued if the job fails.
+// Messages failed more than delivery limit and rejected messages are
+// dead-lettered. If the
+// connection is lost it is reopened with backoff and exchanges, queues
+// and bindings are declared again.
 func (r *ChannelRabbitMq) Receive() {
+	for {
+		if r.Channel == nil {
+			r.App.Connection.Reconnect(func() error {
+				if err := r.dial(); err != nil {
+					return err
+				}
+				if err := r.declare(); err != nil {
+					r.close()
+					return err
+				}
+				return nil
+			})
+		}
+
+		closed := r.Channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		received, control, err := r.consume()
+		if err != nil {
+			r.close()
+			r.App.Connection.Set(model.Disconnected, err)
+			continue
+		}
+
+		go func() {
+			for delivery := range control {
+				r.handle(delivery)
+			}
+		}()
+		for delivery := range received {
+			r.handle(delivery)
+		}
+
+		reason := errors.New("rabbitMQ connection closed")
+		if e := <-closed; e != nil {
+			reason = e
+		}
+		r.close()
+		r.App.Connection.Set(model.Disconnected, reason)
+	}
+}
+
+// consume declare and bind durable node queue and control queue and start
+// consuming them
+func (r *ChannelRabbitMq) consume() (<-chan amqp.Delivery, <-chan amqp.Delivery, error) {
+	if err := r.Channel.Qos(r.prefetch(), 0, false); err != nil {
+		return nil, nil, err
+	}
+
+	received, err := r.queue(r.App.Config.NodeName, r.Exchange())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	control, err := r.queue(r.App.Config.NodeName+".control", r.ControlExchange())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return received, control, nil
+}
+
+// queue declare durable queue, bind it to exchange with binding headers of
+// this node and start consuming it
+func (r *ChannelRabbitMq) queue(name string, exchange string) (<-chan amqp.Delivery, error) {
 	q, err := r.Channel.QueueDeclare(
-		"",
+		name,
+		true,
 		false,
 		false,
-		true,
 		false,
-		nil,
+		amqp.Table{
+			"x-queue-type":           "quorum",
+			"x-delivery-limit":       int32(r.deliveryLimit()),
+			"x-dead-letter-exchange": r.DeadLetterExchange(),
+		},
 	)
 	if err != nil {
-		r.App.Logger.LogError(err, "rabbitMQ error channel queue declare")
+		return nil, err
 	}
 
 	err = r.Channel.QueueBind(
 		q.Name,
 		"",
-		r.App.Config.ChannelName,
+		exchange,
 		false,
-		nil)
+		r.bindingHeaders(r.App.Tags()))
 	if err != nil {
-		r.App.Logger.LogError(err, "rabbitMQ error channel queue bind")
+		return nil, err
 	}
 
-	received, err := r.Channel.Consume(
+	return r.Channel.Consume(
 		q.Name,
 		"",
-		true,
+		false,
 		false,
 		false,
 		false,
 		nil,
 	)
+}
+
+// handle run delivered message and acknowledge it once it is handled. Messages with a forged,
+// expired or invalid envelope are dead-lettered without running.
+func (r *ChannelRabbitMq) handle(delivery amqp.Delivery) {
+	r.App.Logger.LogInfo("Receive rabbitmq message: " + delivery.MessageId)
+
+	message := r.App.Signer.Open(string(delivery.Body))
+	if message == nil {
+		if err := delivery.Nack(false, false); err != nil {
+			r.App.Logger.LogError(err, "rabbitMQ error message dead letter")
+		}
+		return
+	}
+
+	dispatch(r.App, message, func(result *JobResult) {
+		r.acknowledge(delivery, result)
+	})
+}
+
+// acknowledge delivery if the job is finished or dropped, requeue it if
+// the job fails
+func (r *ChannelRabbitMq) acknowledge(delivery amqp.Delivery, result *JobResult) {
+	var err error
+	if result == nil || result.Success() {
+		err = delivery.Ack(false)
+	} else {
+		err = delivery.Nack(false, true)
+	}
 
 	if err != nil {
-		r.App.Logger.LogError(err, "rabbitMQ error channel queue consume")
+		r.App.Logger.LogError(err, "rabbitMQ error message acknowledge")
+	}
+}
+
+// Publish message to rabbitMQ headers exchange. Heartbeats and job replies
+// are published to the control exchange. Message headers are built from
+// message targets.
+func (r *ChannelRabbitMq) Publish(message *model.ReceivedMessage) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.Channel == nil {
+		return errors.New("rabbitMQ is not connected")
+	}
+
+	exchange := r.Exchange()
+	if message.Heartbeat != nil || message.Reply != nil {
+		exchange = r.ControlExchange()
+	}
+
+	return r.Channel.Publish(
+		exchange,
+		"",
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      messageHeaders(message.MessageTargets),
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    message.ID,
+			Body:         []byte(r.App.Signer.Seal(message)),
+		})
+}
+
+// Exchange rabbitMQ headers exchange name. Queues are bound to it with the
+// node code, node type and node tags of the node.
+func (r *ChannelRabbitMq) Exchange() string {
+	return r.App.Config.ChannelName + ".targets"
+}
+
+// ControlExchange rabbitMQ headers exchange of heartbeats and job replies.
+// Control queues are bound to it like node queues to the target exchange.
+func (r *ChannelRabbitMq) ControlExchange() string {
+	return r.App.Config.ChannelName + ".control"
+}
+
+// DeadLetterExchange rabbitMQ exchange and queue name of messages failed
+// more than delivery limit
+func (r *ChannelRabbitMq) DeadLetterExchange() string {
+	return r.App.Config.ChannelName + ".dead"
+}
+
+func (r *ChannelRabbitMq) prefetch() int {
+	if r.App.Config.RabbitMqPrefetch <= 0 {
+		return DefaultRabbitMqPrefetch
+	}
+
+	return r.App.Config.RabbitMqPrefetch
+}
+
+func (r *ChannelRabbitMq) deliveryLimit() int {
+	if r.App.Config.RabbitMqDeliveryLimit <= 0 {
+		return DefaultRabbitMqDeliveryLimit
 	}
 
-	go func() {
-		for receive := range received {
-			r.App.Logger.LogInfo("Receive rabbitmq message: " + string(receive.Body))
-			r.App.Job.Run(model.NewReceivedMessage(string(receive.Body)))
+	return r.App.Config.RabbitMqDeliveryLimit
+}
+
+// Rebind bind node and control queues with headers of new node tags and
+// drop bindings of old node tags. Queues are bound with current tags if
+// the connection is reopened.
+func (r *ChannelRabbitMq) Rebind(old []string, tags []string) error {
+	if r.Channel == nil {
+		return nil
+	}
+
+	queues := map[string]string{
+		r.App.Config.NodeName:              r.Exchange(),
+		r.App.Config.NodeName + ".control": r.ControlExchange(),
+	}
+	for name, exchange := range queues {
+		if err := r.Channel.QueueBind(name, "", exchange, false, r.bindingHeaders(tags)); err != nil {
+			return err
 		}
-	}()
+		if err := r.Channel.QueueUnbind(name, "", exchange, r.bindingHeaders(old)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindingHeaders queue binding headers matching broadcast messages and
+// messages targeting this node with given tags
+func (r *ChannelRabbitMq) bindingHeaders(tags []string) amqp.Table {
+	headers := amqp.Table{
+		"x-match":                               "any",
+		"all":                                   "1",
+		"node:" + r.App.Config.NodeName:         "1",
+		"type:" + string(r.App.Config.NodeType): "1",
+	}
+	for _, tag := range tags {
+		headers["tag:"+tag] = "1"
+	}
+
+	return headers
+}
+
+// messageHeaders rabbitMQ message headers of given message targets
+func messageHeaders(targets model.MessageTargets) amqp.Table {
+	if targets.Broadcast() {
+		return amqp.Table{"all": "1"}
+	}
 
-	<-r.App.Channel
+	headers := amqp.Table{}
+	for _, node := range targets.Nodes {
+		headers["node:"+node] = "1"
+	}
+	for _, typ := range targets.NodeTypes {
+		headers["type:"+string(typ)] = "1"
+	}
+	for _, tag := range targets.Tags {
+		headers["tag:"+tag] = "1"
+	}
 
-	defer r.Channel.Close()
-	defer r.Conn.Close()
+	return headers
 }
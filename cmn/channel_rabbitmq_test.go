@@ -4,17 +4,32 @@ import (
 	"errors"
 	"github.com/streetbyters/agente/model"
 	"github.com/streetbyters/agente/utils"
+	"net"
 	"os"
 	"testing"
+	"time"
 )
 
 var logger = utils.NewLogger("test")
 var appPath, _ = os.Getwd()
 
+// skipWithoutService skip the test if the service is not listening on the
+// given address
+func skipWithoutService(t *testing.T, address string) {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		t.Skipf("service is not available on %s: %v", address, err)
+	}
+	conn.Close()
+}
+
 func Test_NewRabbitMq(t *testing.T) {
+	skipWithoutService(t, "127.0.0.1:5672")
+
 	config := &model.Config{
 		Path:         appPath,
 		Mode:         model.Test,
+		Channel:      model.RabbitMqChannel,
 		RabbitMq:     false,
 		RabbitMqHost: "127.0.0.1",
 		RabbitMqPort: 5672,
@@ -19,8 +19,10 @@ package cmn
 import (
 	"github.com/go-redis/redis/v7"
 	"github.com/streetbyters/agente/model"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ChannelRedis queuing structure
@@ -33,47 +35,150 @@ type ChannelRedis struct {
 
 // NewRedis building redis queuing
 func NewRedis(app *App) *ChannelRedis {
+	useConnection(app)
+
 	return &ChannelRedis{App: app}
 }
 
-// Start Redis Conn
-func (r *ChannelRedis) Start() {
-	client := redis.NewClient(&redis.Options{
-		Network:   "tcp",
-		Addr:      strings.Join([]string{r.App.Config.RedisHost, strconv.Itoa(r.App.Config.RedisPort)}, ":"),
-		Dialer:    nil,
-		OnConnect: nil,
-		Password:  r.App.Config.RedisPass,
-		DB:        r.App.Config.RedisDB,
-		PoolSize:  5,
-	})
+// RedisPingInterval idle duration of redis subscription before the
+// connection is checked
+const RedisPingInterval = 30 * time.Second
 
-	_, err := client.Ping().Result()
-	if err != nil {
-		panic(err)
-	}
-	r.Client = client
+// Start Redis Conn. If the server is not reachable the client reconnects
+// on next command.
+func (r *ChannelRedis) Start() {
+	r.Client = newRedisClient(r.App)
 	r.App.Logger.LogInfo("Start Redis connection")
+	pingRedis(r.App, r.Client)
 }
 
-// Subscribe redis channel
+// Subscribe redis broadcast channel and node, node type and node tag
+// channels of this node
 func (r *ChannelRedis) Subscribe() {
-	r.PubSub = r.Client.Subscribe(r.App.Config.ChannelName)
+	channels := []string{
+		r.App.Config.ChannelName,
+		r.channel("node", r.App.Config.NodeName),
+		r.channel("type", string(r.App.Config.NodeType)),
+	}
+	channels = append(channels, r.tagChannels(r.App.Tags())...)
+
+	r.PubSub = r.Client.Subscribe(channels...)
 }
 
-// Receive redis channel
+// Rebind unsubscribe channels of removed node tags and subscribe channels
+// of added node tags
+func (r *ChannelRedis) Rebind(old []string, tags []string) error {
+	if r.PubSub == nil {
+		return nil
+	}
+
+	removed, added := diffTags(old, tags)
+	if len(removed) > 0 {
+		if err := r.PubSub.Unsubscribe(r.tagChannels(removed)...); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		return r.PubSub.Subscribe(r.tagChannels(added)...)
+	}
+
+	return nil
+}
+
+// Receive redis channel. Subscription is restored by the redis client
+// after a lost connection, connection state is updated on every read.
 func (r *ChannelRedis) Receive() {
-	_, err := r.PubSub.Receive()
-	if err != nil {
-		r.App.Logger.LogError(err, "redis error channel receive")
+	defer r.Client.Close()
+
+	attempt := 0
+	for {
+		received, err := r.PubSub.ReceiveTimeout(RedisPingInterval)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				err = r.PubSub.Ping()
+			}
+		}
+		if err != nil {
+			r.App.Connection.Set(model.Disconnected, err)
+			time.Sleep(Backoff(attempt))
+			attempt++
+			continue
+		}
+
+		attempt = 0
+		r.App.Connection.Set(model.Connected, nil)
+
+		if message, ok := received.(*redis.Message); ok {
+			r.App.Logger.LogInfo("Receive redis message: " + message.Channel)
+			dispatch(r.App, r.App.Signer.Open(message.Payload), nil)
+		}
+	}
+}
+
+// Publish message to redis broadcast channel or to every target channel of
+// the message. Nodes receiving a message more than once drop duplicates.
+func (r *ChannelRedis) Publish(message *model.ReceivedMessage) error {
+	if message.Broadcast() {
+		return r.Client.Publish(r.App.Config.ChannelName, r.App.Signer.Seal(message)).Err()
 	}
 
-	ch := r.PubSub.Channel()
+	var channels []string
+	for _, node := range message.Nodes {
+		channels = append(channels, r.channel("node", node))
+	}
+	for _, typ := range message.NodeTypes {
+		channels = append(channels, r.channel("type", string(typ)))
+	}
+	for _, tag := range message.Tags {
+		channels = append(channels, r.channel("tag", tag))
+	}
 
-	for received := range ch {
-		r.App.Logger.LogInfo("Receive redis message: " + received.Payload)
-		r.App.Job.Run(model.NewReceivedMessage(received.Payload))
+	payload := r.App.Signer.Seal(message)
+	for _, channel := range channels {
+		if err := r.Client.Publish(channel, payload).Err(); err != nil {
+			return err
+		}
 	}
 
-	defer r.Client.Close()
+	return nil
+}
+
+// tagChannels redis channels of given node tags
+func (r *ChannelRedis) tagChannels(tags []string) []string {
+	var channels []string
+	for _, tag := range tags {
+		channels = append(channels, r.channel("tag", tag))
+	}
+
+	return channels
+}
+
+// channel redis channel name of given target
+func (r *ChannelRedis) channel(target string, name string) string {
+	return strings.Join([]string{r.App.Config.ChannelName, target, name}, ".")
+}
+
+// newRedisClient client of configured redis server
+func newRedisClient(app *App) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Network:   "tcp",
+		Addr:      strings.Join([]string{app.Config.RedisHost, strconv.Itoa(app.Config.RedisPort)}, ":"),
+		Dialer:    nil,
+		OnConnect: nil,
+		Password:  app.Config.RedisPass,
+		DB:        app.Config.RedisDB,
+		PoolSize:  5,
+	})
+
+	return client
+}
+
+// pingRedis check redis connection and update connection state
+func pingRedis(app *App, client *redis.Client) {
+	app.Connection.Set(model.Connecting, nil)
+	if err := client.Ping().Err(); err != nil {
+		app.Connection.Set(model.Disconnected, err)
+		return
+	}
+	app.Connection.Set(model.Connected, nil)
 }
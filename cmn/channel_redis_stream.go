@@ -0,0 +1,254 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v7"
+	"github.com/streetbyters/agente/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRedisStreamMaxLen approximate number of entries kept in the stream
+// if REDIS_STREAM_MAXLEN is not set
+const DefaultRedisStreamMaxLen = 10000
+
+// RedisStreamDeliveryLimit deliveries of a failing entry before it is moved
+// to the dead stream
+const RedisStreamDeliveryLimit = 5
+
+// RedisStreamReclaimIdle idle duration of a pending entry before it is
+// claimed and delivered again
+const RedisStreamReclaimIdle = time.Minute
+
+// ChannelRedisStream redis streams queuing structure. Every node reads the
+// stream with its own consumer group so that entries are kept until the
+// node acknowledges them.
+type ChannelRedisStream struct {
+	ChannelInterface
+	App     *App
+	Client  *redis.Client
+	running sync.Map
+}
+
+// NewRedisStream building redis streams queuing
+func NewRedisStream(app *App) *ChannelRedisStream {
+	useConnection(app)
+
+	return &ChannelRedisStream{App: app}
+}
+
+// Start Redis Conn
+func (r *ChannelRedisStream) Start() {
+	r.Client = newRedisClient(r.App)
+	r.App.Logger.LogInfo("Start Redis stream connection")
+	pingRedis(r.App, r.Client)
+}
+
+// Subscribe create consumer group of this node
+func (r *ChannelRedisStream) Subscribe() {
+	err := r.Client.XGroupCreateMkStream(r.Stream(), r.App.Config.NodeName, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		r.App.Logger.LogError(err, "redis error stream group create")
+	}
+}
+
+// Receive read new stream entries of node consumer group. Entries are
+// acknowledged after the job is finished, failed entries stay pending and
+// are claimed again. Consumer group is created again if the stream is
+// lost while the connection was down.
+func (r *ChannelRedisStream) Receive() {
+	reclaimed := time.Time{}
+	attempt := 0
+
+	for {
+		if time.Since(reclaimed) >= RedisStreamReclaimIdle/2 {
+			r.reclaim()
+			reclaimed = time.Now()
+		}
+
+		streams, err := r.Client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    r.App.Config.NodeName,
+			Consumer: r.App.Config.NodeName,
+			Streams:  []string{r.Stream(), ">"},
+			Count:    10,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			r.App.Connection.Set(model.Disconnected, err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				r.Subscribe()
+			}
+			time.Sleep(Backoff(attempt))
+			attempt++
+			continue
+		}
+
+		attempt = 0
+		r.App.Connection.Set(model.Connected, nil)
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				r.handle(entry)
+			}
+		}
+	}
+}
+
+// Publish message to redis stream
+func (r *ChannelRedisStream) Publish(message *model.ReceivedMessage) error {
+	return r.Client.XAdd(&redis.XAddArgs{
+		Stream:       r.Stream(),
+		MaxLenApprox: r.maxLen(),
+		Values:       map[string]interface{}{"message": r.App.Signer.Seal(message)},
+	}).Err()
+}
+
+// Stream redis stream name
+func (r *ChannelRedisStream) Stream() string {
+	return r.App.Config.ChannelName + ".stream"
+}
+
+// DeadStream redis stream name of entries failed more than delivery limit
+func (r *ChannelRedisStream) DeadStream() string {
+	return r.Stream() + ".dead"
+}
+
+func (r *ChannelRedisStream) maxLen() int64 {
+	if r.App.Config.RedisStreamMaxLen <= 0 {
+		return DefaultRedisStreamMaxLen
+	}
+
+	return int64(r.App.Config.RedisStreamMaxLen)
+}
+
+// handle run stream entry and acknowledge it if the job is finished or
+// dropped. Entries with a forged, expired or invalid message are moved to
+// the dead stream without running. Entry already handed over to the job
+// worker is skipped.
+func (r *ChannelRedisStream) handle(entry redis.XMessage) {
+	message, err := streamMessage(r.App.Signer, entry)
+	if err != nil {
+		r.App.Logger.LogError(err, "redis error stream entry "+entry.ID)
+		r.dead(entry)
+		return
+	}
+	if _, running := r.running.LoadOrStore(entry.ID, true); running {
+		return
+	}
+	r.App.Logger.LogInfo("Receive redis stream message: " + entry.ID)
+
+	dispatch(r.App, message, func(result *JobResult) {
+		r.running.Delete(entry.ID)
+		if result != nil && !result.Success() {
+			return
+		}
+
+		if err := r.Client.XAck(r.Stream(), r.App.Config.NodeName, entry.ID).Err(); err != nil {
+			r.App.Logger.LogError(err, "redis error stream ack")
+		}
+	})
+}
+
+// reclaim claim pending entries of crashed or failed deliveries. Entries
+// failed more than delivery limit are moved to the dead stream. Entries
+// waiting for or running in the job worker are not claimed.
+func (r *ChannelRedisStream) reclaim() {
+	pending, err := r.Client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: r.Stream(),
+		Group:  r.App.Config.NodeName,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		if err != redis.Nil {
+			r.App.Logger.LogError(err, "redis error stream pending")
+		}
+		return
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if _, running := r.running.Load(p.ID); !running && p.Idle >= RedisStreamReclaimIdle {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	entries, err := r.Client.XClaim(&redis.XClaimArgs{
+		Stream:   r.Stream(),
+		Group:    r.App.Config.NodeName,
+		Consumer: r.App.Config.NodeName,
+		MinIdle:  RedisStreamReclaimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		r.App.Logger.LogError(err, "redis error stream claim")
+		return
+	}
+
+	retries := make(map[string]int64)
+	for _, p := range pending {
+		retries[p.ID] = p.RetryCount
+	}
+
+	for _, entry := range entries {
+		if retries[entry.ID] >= RedisStreamDeliveryLimit {
+			r.dead(entry)
+			continue
+		}
+		r.handle(entry)
+	}
+}
+
+// dead move stream entry to the dead stream
+func (r *ChannelRedisStream) dead(entry redis.XMessage) {
+	err := r.Client.XAdd(&redis.XAddArgs{
+		Stream:       r.DeadStream(),
+		MaxLenApprox: r.maxLen(),
+		Values:       entry.Values,
+	}).Err()
+	if err == nil {
+		err = r.Client.XAck(r.Stream(), r.App.Config.NodeName, entry.ID).Err()
+	}
+	if err != nil {
+		r.App.Logger.LogError(err, "redis error stream dead letter")
+		return
+	}
+
+	r.App.Logger.LogInfo("Moved redis stream entry to dead stream: " + entry.ID)
+}
+
+// streamMessage verified queuing message of redis stream entry
+func streamMessage(signer *MessageSigner, entry redis.XMessage) (*model.ReceivedMessage, error) {
+	payload, ok := entry.Values["message"].(string)
+	if !ok {
+		return nil, errors.New("stream entry has no message")
+	}
+
+	message := signer.Open(payload)
+	if message == nil {
+		return nil, errors.New("stream entry message is rejected")
+	}
+
+	return message, nil
+}
@@ -0,0 +1,352 @@
+package cmn
+
+import (
+	"github.com/go-redis/redis/v7"
+	"github.com/streadway/amqp"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_NewChannel(t *testing.T) {
+	app := &App{Config: &model.Config{RabbitMqHost: "127.0.0.1"}, Logger: logger}
+	if _, ok := NewChannel(app).(*ChannelRabbitMq); !ok || !app.Config.RabbitMq {
+		t.Fatal("rabbitMQ should be chosen from rabbitMQ host")
+	}
+
+	app = &App{Config: &model.Config{RedisHost: "127.0.0.1"}, Logger: logger}
+	if _, ok := NewChannel(app).(*ChannelRedis); !ok || !app.Config.Redis {
+		t.Fatal("redis should be chosen from redis host")
+	}
+
+	app = &App{Config: &model.Config{Channel: model.MemoryChannel, RabbitMqHost: "127.0.0.1"}, Logger: logger}
+	if _, ok := NewChannel(app).(*ChannelMemory); !ok || app.Config.RabbitMq {
+		t.Fatal("configured channel should be chosen")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("undefined channel should panic")
+		}
+	}()
+	NewChannel(&App{Config: &model.Config{Channel: "kafka"}, Logger: logger})
+}
+
+func Test_NewMemoryChannel(t *testing.T) {
+	config := &model.Config{
+		Path:        appPath,
+		Mode:        model.Test,
+		Channel:     model.MemoryChannel,
+		ChannelName: "agente_test",
+		Scheduler:   "JobRunner",
+	}
+	app := NewApp(config, logger)
+
+	channelMemory := NewMemory(app)
+	if app != channelMemory.App {
+		t.Fatal("memory channel should be built with the app")
+	}
+}
+
+func Test_NewAppWithMemoryChannel(t *testing.T) {
+	app := NewApp(&model.Config{
+		Mode:        model.Test,
+		Channel:     model.MemoryChannel,
+		ChannelName: "agente_test",
+	}, logger)
+
+	queue, ok := app.Queue.(*ChannelMemory)
+	if !ok {
+		t.Fatal("app queue should be in-process channel")
+	}
+
+	if err := queue.Publish(model.NewJobMessage("job", model.Other)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(queue.Messages) != 1 {
+		t.Fatal("messages should not be received before the app starts receiving")
+	}
+}
+
+func Test_ChannelMemoryPublish(t *testing.T) {
+	app := &App{Config: &model.Config{Channel: model.MemoryChannel}, Logger: logger}
+	queue := NewMemory(app)
+	queue.Start()
+
+	message := model.NewJobMessage("job", model.Other)
+	if message.ID == "" {
+		t.Fatal("message should have an identifier")
+	}
+
+	for i := 0; i < ChannelMemoryBuffer; i++ {
+		if err := queue.Publish(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := queue.Publish(message); err == nil {
+		t.Fatal("publish should be failed if channel is full")
+	}
+
+	if received := <-queue.Messages; received.ID != message.ID || received.JobName != "job" {
+		t.Fatalf("unexpected message: %v", received)
+	}
+}
+
+func Test_MessageCache(t *testing.T) {
+	cache := NewMessageCache(50 * time.Millisecond)
+	if cache.Seen("a") || !cache.Seen("a") || cache.Seen("b") {
+		t.Fatal("message should be seen only after it is recorded")
+	}
+
+	cache.Forget("b")
+	if cache.Seen("b") {
+		t.Fatal("forgotten message should not be seen")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if cache.Seen("a") {
+		t.Fatal("expired message should not be seen")
+	}
+}
+
+func Test_PersistMessageCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &App{Config: &model.Config{LibPath: dir, NodeName: "node1"}, Logger: logger}
+
+	cache := NewMessageCache(time.Hour)
+	if err := cache.Persist(MessageCachePath(app)); err != nil {
+		t.Fatal(err)
+	}
+	cache.Seen("a")
+	cache.Seen("b")
+	cache.Forget("b")
+	cache.Close()
+
+	restarted := NewMessageCache(time.Hour)
+	if err := restarted.Persist(MessageCachePath(app)); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	if !restarted.Seen("a") {
+		t.Fatal("message seen before restart should be seen")
+	}
+	if restarted.Seen("b") {
+		t.Fatal("forgotten message should not be seen after restart")
+	}
+}
+
+func Test_ReceiveTargetedMessages(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+	app.Config.NodeName = "node1"
+	app.Config.NodeType = model.Worker
+	app.Config.Tags = []string{"web"}
+	app.Messages = NewMessageCache(DefaultMessageTTL)
+
+	if receive(app, nil) != nil {
+		t.Fatal("invalid message should be dropped")
+	}
+
+	message := model.NewJobMessage("job", model.Other)
+	message.Nodes = []string{"node2"}
+	if receive(app, message) != nil {
+		t.Fatal("message for other nodes should be dropped")
+	}
+
+	message = model.NewJobMessage("job", model.Other)
+	message.Tags = []string{"web"}
+	if receive(app, message) == nil {
+		t.Fatal("message for node tag should be run")
+	}
+	if receive(app, message) == nil {
+		t.Fatal("failed message should be run again")
+	}
+
+	app.Messages.Seen("done")
+	message.ID = "done"
+	if receive(app, message) != nil {
+		t.Fatal("duplicated message should be dropped")
+	}
+}
+
+func Test_DispatchHeartbeatWhileJobIsWaiting(t *testing.T) {
+	app := &App{
+		Config:   &model.Config{NodeName: "node_master@host", NodeType: model.Master},
+		Logger:   logger,
+		Messages: NewMessageCache(time.Hour),
+		Worker:   NewJobWorker(),
+	}
+
+	dispatch(app, model.NewJobMessage("job", model.Other), func(result *JobResult) {
+		t.Fatal("job should wait for the job worker")
+	})
+
+	message := model.NewHeartbeatMessage(&model.NodeHeartbeat{Node: "node_worker@host", Type: model.Worker})
+	handled := false
+	for i := 0; i < 2; i++ {
+		dispatch(app, message, func(result *JobResult) {
+			handled = result == nil
+		})
+		if !handled {
+			t.Fatal("heartbeat should be handled while a job is waiting")
+		}
+	}
+
+	if app.Messages.Seen(message.ID) {
+		t.Fatal("heartbeat should not be kept to drop duplicates")
+	}
+	if len(app.Worker.tasks) != 1 {
+		t.Fatalf("job should be queued for the job worker: %d", len(app.Worker.tasks))
+	}
+}
+
+func Test_RabbitMqHeaders(t *testing.T) {
+	app := &App{Config: &model.Config{
+		NodeName:    "node1",
+		NodeType:    model.Worker,
+		Tags:        []string{"web"},
+		ChannelName: "agente",
+	}, Logger: logger}
+	r := NewRabbitMq(app)
+
+	binding := r.bindingHeaders(app.Config.Tags)
+	if binding["x-match"] != "any" || binding["node:node1"] != "1" ||
+		binding["type:worker"] != "1" || binding["tag:web"] != "1" || binding["all"] != "1" {
+		t.Fatalf("unexpected binding headers: %v", binding)
+	}
+
+	headers := messageHeaders(model.MessageTargets{})
+	if len(headers) != 1 || headers["all"] != "1" {
+		t.Fatalf("unexpected broadcast headers: %v", headers)
+	}
+
+	headers = messageHeaders(model.MessageTargets{Nodes: []string{"node2"}, Tags: []string{"db"}})
+	if len(headers) != 2 || headers["node:node2"] != "1" || headers["tag:db"] != "1" {
+		t.Fatalf("unexpected target headers: %v", headers)
+	}
+}
+
+type testAcknowledger struct {
+	acked    bool
+	requeued bool
+	dead     bool
+}
+
+func (a *testAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *testAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.requeued = requeue
+	a.dead = !requeue
+	return nil
+}
+
+func (a *testAcknowledger) Reject(tag uint64, requeue bool) error {
+	return nil
+}
+
+func Test_RabbitMqAcknowledge(t *testing.T) {
+	r := NewRabbitMq(&App{Config: &model.Config{}, Logger: logger})
+
+	for _, result := range []*JobResult{nil, {Code: "job"}} {
+		ack := &testAcknowledger{}
+		r.acknowledge(amqp.Delivery{Acknowledger: ack}, result)
+		if !ack.acked || ack.requeued || ack.dead {
+			t.Fatal("finished or dropped message should be acknowledged")
+		}
+	}
+
+	ack := &testAcknowledger{}
+	r.acknowledge(amqp.Delivery{Acknowledger: ack}, &JobResult{Code: "job", ExitCode: 1})
+	if ack.acked || !ack.requeued {
+		t.Fatal("failed message should be requeued")
+	}
+
+	if r.prefetch() != DefaultRabbitMqPrefetch || r.deliveryLimit() != DefaultRabbitMqDeliveryLimit {
+		t.Fatal("default prefetch and delivery limit should be used")
+	}
+}
+
+func Test_RabbitMqDelayedRedelivery(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+	app.Config.SecretKey = "secret"
+	app.Signer = NewMessageSigner(app)
+	app.Messages = NewMessageCache(app.Signer.MaxAge + model.MessageClockSkew)
+	r := NewRabbitMq(app)
+
+	message := model.NewJobMessage("job", model.Other)
+	delayed := []byte(model.NewMessageEnvelope(message, "node_master@host", app.Signer.Key,
+		time.Now().Add(-time.Hour)).ToJSON())
+
+	for i := 0; i < 2; i++ {
+		ack := &testAcknowledger{}
+		r.handle(amqp.Delivery{Acknowledger: ack, Body: delayed})
+		if ack.acked || !ack.requeued {
+			t.Fatal("delayed failing message should be run and requeued")
+		}
+	}
+
+	app.Messages.Seen(message.ID)
+	ack := &testAcknowledger{}
+	r.handle(amqp.Delivery{Acknowledger: ack, Body: delayed})
+	if !ack.acked || ack.requeued || ack.dead {
+		t.Fatal("redelivered finished message should be dropped and acknowledged")
+	}
+
+	expired := model.NewMessageEnvelope(model.NewJobMessage("job", model.Other), "node_master@host",
+		app.Signer.Key, time.Now().Add(-app.Signer.MaxAge-time.Hour)).ToJSON()
+	forged := model.NewMessageEnvelope(model.NewJobMessage("job", model.Other), "node_master@host",
+		[]byte("other"), time.Now()).ToJSON()
+	for _, body := range []string{expired, forged, "{"} {
+		ack := &testAcknowledger{}
+		r.handle(amqp.Delivery{Acknowledger: ack, Body: []byte(body)})
+		if ack.acked || ack.requeued || !ack.dead {
+			t.Fatalf("rejected message should be dead-lettered: %s", body)
+		}
+	}
+	if app.Signer.Rejected() != 3 {
+		t.Fatalf("unexpected rejected count: %d", app.Signer.Rejected())
+	}
+}
+
+func Test_RedisStreamMessage(t *testing.T) {
+	signer := NewMessageSigner(&App{Config: &model.Config{SecretKey: "secret"}, Logger: logger})
+	message := model.NewJobMessage("job", model.Other)
+	received, err := streamMessage(signer, redis.XMessage{ID: "1-0", Values: map[string]interface{}{
+		"message": signer.Seal(message),
+	}})
+	if err != nil || received.ID != message.ID || received.JobName != "job" {
+		t.Fatalf("unexpected message: %v %v", received, err)
+	}
+
+	if _, err := streamMessage(signer, redis.XMessage{ID: "2-0", Values: map[string]interface{}{}}); err == nil {
+		t.Fatal("entry without message should be invalid")
+	}
+	if _, err := streamMessage(signer, redis.XMessage{ID: "3-0", Values: map[string]interface{}{"message": "{"}}); err == nil {
+		t.Fatal("entry with invalid message should be invalid")
+	}
+	if _, err := streamMessage(signer, redis.XMessage{ID: "4-0", Values: map[string]interface{}{
+		"message": message.ToJSON(),
+	}}); err == nil {
+		t.Fatal("entry with unsigned message should be invalid")
+	}
+
+	app := &App{Config: &model.Config{Channel: model.RedisStreamChannel, ChannelName: "agente"}, Logger: logger}
+	r, ok := NewChannel(app).(*ChannelRedisStream)
+	if !ok || !app.Config.Redis {
+		t.Fatal("redis stream channel should be chosen")
+	}
+	if r.Stream() != "agente.stream" || r.DeadStream() != "agente.stream.dead" || r.maxLen() != DefaultRedisStreamMaxLen {
+		t.Fatal("unexpected stream configuration")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"github.com/streetbyters/agente/model"
+	"sync"
+	"time"
+)
+
+// ReconnectMinDelay first delay between queuing system connection attempts
+const ReconnectMinDelay = time.Second
+
+// ReconnectMaxDelay maximum delay between queuing system connection attempts
+const ReconnectMaxDelay = time.Minute
+
+// Connection queuing system connection state of the app
+type Connection struct {
+	App        *App
+	state      model.ConnectionState
+	since      time.Time
+	err        error
+	reconnects int
+	connected  bool
+	mutex      sync.RWMutex
+}
+
+// NewConnection building queuing system connection state
+func NewConnection(app *App) *Connection {
+	return &Connection{App: app, state: model.Connecting, since: time.Now().UTC()}
+}
+
+// useConnection create connection state of the app if there is none
+func useConnection(app *App) {
+	if app.Connection == nil {
+		app.Connection = NewConnection(app)
+	}
+}
+
+// Set connection state. Every state transition is logged.
+func (c *Connection) Set(state model.ConnectionState, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.err = err
+	if c.state == state {
+		return
+	}
+
+	if state == model.Connected && c.connected {
+		c.reconnects++
+	}
+	if state == model.Connected {
+		c.connected = true
+	}
+
+	c.state = state
+	c.since = time.Now().UTC()
+
+	if err != nil {
+		c.App.Logger.LogError(err, "Channel "+string(c.App.Config.Channel)+" is "+string(state))
+	} else {
+		c.App.Logger.LogInfo("Channel " + string(c.App.Config.Channel) + " is " + string(state))
+	}
+}
+
+// State current connection state
+func (c *Connection) State() model.ConnectionState {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.state
+}
+
+// Status connection status
+func (c *Connection) Status() model.ChannelStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	status := model.ChannelStatus{
+		Channel:    c.App.Config.Channel,
+		State:      c.state,
+		Since:      c.since,
+		Reconnects: c.reconnects,
+	}
+	if c.err != nil {
+		status.Error = c.err.Error()
+	}
+
+	return status
+}
+
+// Backoff delay before the given connection attempt. Delay is doubled on
+// every attempt up to ReconnectMaxDelay.
+func Backoff(attempt int) time.Duration {
+	delay := ReconnectMinDelay
+	for i := 0; i < attempt && delay < ReconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > ReconnectMaxDelay {
+		delay = ReconnectMaxDelay
+	}
+
+	return delay
+}
+
+// Reconnect call connect until it succeeds waiting exponential backoff
+// between attempts
+func (c *Connection) Reconnect(connect func() error) {
+	for attempt := 0; ; attempt++ {
+		c.Set(model.Connecting, nil)
+		err := connect()
+		if err == nil {
+			c.Set(model.Connected, nil)
+			return
+		}
+
+		c.Set(model.Disconnected, err)
+		time.Sleep(Backoff(attempt))
+	}
+}
@@ -0,0 +1,66 @@
+package cmn
+
+import (
+	"errors"
+	"github.com/streetbyters/agente/model"
+	"testing"
+	"time"
+)
+
+func Test_ConnectionState(t *testing.T) {
+	app := &App{Config: &model.Config{Channel: model.RedisChannel}, Logger: logger}
+	connection := NewConnection(app)
+
+	if connection.State() != model.Connecting {
+		t.Fatalf("unexpected state: %s", connection.State())
+	}
+
+	connection.Set(model.Connected, nil)
+	connection.Set(model.Disconnected, errors.New("connection refused"))
+
+	status := connection.Status()
+	if status.State != model.Disconnected || status.Error != "connection refused" || status.Reconnects != 0 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	connection.Set(model.Connecting, nil)
+	connection.Set(model.Connected, nil)
+
+	status = connection.Status()
+	if status.State != model.Connected || status.Error != "" || status.Reconnects != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if status.Channel != model.RedisChannel {
+		t.Fatalf("unexpected channel: %s", status.Channel)
+	}
+}
+
+func Test_ConnectionReconnect(t *testing.T) {
+	app := &App{Config: &model.Config{}, Logger: logger}
+	connection := NewConnection(app)
+
+	attempts := 0
+	connection.Reconnect(func() error {
+		attempts++
+		if attempts < 2 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	if attempts != 2 || connection.State() != model.Connected {
+		t.Fatalf("unexpected reconnect: %d attempts, %s", attempts, connection.State())
+	}
+}
+
+func Test_Backoff(t *testing.T) {
+	if Backoff(0) != ReconnectMinDelay {
+		t.Fatalf("unexpected first delay: %s", Backoff(0))
+	}
+	if Backoff(3) != 8*time.Second {
+		t.Fatalf("unexpected delay: %s", Backoff(3))
+	}
+	if Backoff(100) != ReconnectMaxDelay {
+		t.Fatalf("unexpected max delay: %s", Backoff(100))
+	}
+}
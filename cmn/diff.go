@@ -0,0 +1,250 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffMaxEdits max line edits searched for a shortest diff. Lines of a
+// larger change are diffed as deleted and inserted as a whole.
+var DiffMaxEdits = 1000
+
+// DiffContext unchanged lines around changes in unified diffs
+const DiffContext = 3
+
+// DiffOp operation of a diff line
+type DiffOp byte
+
+const (
+	// DiffEqual line is in both texts
+	DiffEqual DiffOp = ' '
+	// DiffDelete line is only in the old text
+	DiffDelete DiffOp = '-'
+	// DiffInsert line is only in the new text
+	DiffInsert DiffOp = '+'
+)
+
+// DiffLine line of a diff
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// SplitLines split text into lines keeping their line breaks
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// DiffLines shortest line diff of the old and new lines
+func DiffLines(a, b []string) []DiffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+	for _, line := range a[:prefix] {
+		lines = append(lines, DiffLine{DiffEqual, line})
+	}
+	lines = append(lines, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, DiffLine{DiffEqual, line})
+	}
+
+	return lines
+}
+
+// myers diff lines with the Myers O(ND) algorithm. Furthest reaching x of
+// every diagonal k is traced for each edit count d to walk the shortest
+// path back.
+func myers(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > DiffMaxEdits {
+		max = DiffMaxEdits
+	}
+
+	v := make([]int, 2*max+3)
+	offset := max + 1
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	var lines []DiffLine
+	for _, line := range a {
+		lines = append(lines, DiffLine{DiffDelete, line})
+	}
+	for _, line := range b {
+		lines = append(lines, DiffLine{DiffInsert, line})
+	}
+
+	return lines
+}
+
+// backtrack walk the traced furthest reaching paths back from the end of
+// both texts
+func backtrack(trace [][]int, a, b []string) []DiffLine {
+	var lines []DiffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int {
+			if k < -d || k > d {
+				return 0
+			}
+			return v[k+d]
+		}
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, DiffLine{DiffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				lines = append(lines, DiffLine{DiffInsert, b[y-1]})
+			} else {
+				lines = append(lines, DiffLine{DiffDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
+
+// UnifiedDiff unified format diff of the old and new text with count of
+// added and deleted lines
+func UnifiedDiff(from, to string, a, b string) (string, int, int) {
+	lines := DiffLines(SplitLines(a), SplitLines(b))
+
+	var additions, deletions int
+	var changes []int
+	for i, line := range lines {
+		switch line.Op {
+		case DiffInsert:
+			additions++
+			changes = append(changes, i)
+		case DiffDelete:
+			deletions++
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", 0, 0
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+
+	// line numbers of the old and new text before each diff line
+	oldLine, newLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if line.Op != DiffInsert {
+			oldLine[i+1]++
+		}
+		if line.Op != DiffDelete {
+			newLine[i+1]++
+		}
+	}
+
+	for c := 0; c < len(changes); {
+		start := changes[c] - DiffContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[c] + DiffContext + 1
+		for c++; c < len(changes) && changes[c]-DiffContext <= end; c++ {
+			end = changes[c] + DiffContext + 1
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]),
+			hunkRange(newLine[start], newLine[end]-newLine[start]))
+		for _, line := range lines[start:end] {
+			out.WriteByte(byte(line.Op))
+			out.WriteString(line.Text)
+			if !strings.HasSuffix(line.Text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return out.String(), additions, deletions
+}
+
+// hunkRange unified diff range of lines after line start
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
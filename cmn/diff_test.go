@@ -0,0 +1,87 @@
+package cmn
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_UnifiedDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk"
+
+	diff, additions, deletions := UnifiedDiff("a.txt", "b.txt", a, b)
+	expected := "--- a.txt\n+++ b.txt\n" +
+		"@@ -1,10 +1,11 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n h\n i\n j\n+k\n\\ No newline at end of file\n"
+	if diff != expected || additions != 2 || deletions != 1 {
+		t.Fatalf("unexpected diff: %d %d\n%s", additions, deletions, diff)
+	}
+
+	a = strings.Repeat("line\n", 10) + "old\n" + strings.Repeat("line\n", 10) + "old\n"
+	b = strings.Repeat("line\n", 10) + strings.Repeat("line\n", 10) + "new\n"
+	diff, _, _ = UnifiedDiff("a", "b", a, b)
+	expected = "--- a\n+++ b\n" +
+		"@@ -8,7 +8,6 @@\n line\n line\n line\n-old\n line\n line\n line\n" +
+		"@@ -19,4 +18,4 @@\n line\n line\n line\n-old\n+new\n"
+	if diff != expected {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+
+	if diff, _, _ := UnifiedDiff("a", "b", a, a); diff != "" {
+		t.Fatalf("same texts should not have a diff:\n%s", diff)
+	}
+}
+
+func Test_DiffLines(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "d"}
+	text := func() []string {
+		lines := make([]string, random.Intn(12))
+		for i := range lines {
+			lines[i] = words[random.Intn(len(words))]
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := text(), text()
+		var old, new []string
+		edits := 0
+		for _, line := range DiffLines(a, b) {
+			if line.Op != DiffInsert {
+				old = append(old, line.Text)
+			}
+			if line.Op != DiffDelete {
+				new = append(new, line.Text)
+			}
+			if line.Op != DiffEqual {
+				edits++
+			}
+		}
+		if strings.Join(old, ",") != strings.Join(a, ",") || strings.Join(new, ",") != strings.Join(b, ",") {
+			t.Fatalf("diff does not restore texts: %v %v", a, b)
+		}
+		if edits != len(a)+len(b)-2*lcs(a, b) {
+			t.Fatalf("diff is not the shortest: %v %v", a, b)
+		}
+	}
+}
+
+func lcs(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else if l[i+1][j] > l[i][j+1] {
+				l[i][j] = l[i+1][j]
+			} else {
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	return l[0][0]
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// FileFetchTimeout timeout of fetching distributed file content
+var FileFetchTimeout = 30 * time.Minute
+
+// FileChecksum sha256 checksum and size of the file at path
+func FileChecksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// FetchFile download content of the distributed file, verify its checksum
+// and register it as a child file of this node. Nodes which already have
+// the blob with the same checksum do not download it again.
+func FetchFile(app *App, distribution *model.FileDistribution) (*model2.File, error) {
+	if app.Database == nil || app.Node == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	parent := model2.NewFile()
+	res := app.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE id = $1", parent.TableName()),
+		parent,
+		distribution.FileID)
+	if res.Error != nil {
+		return nil, fmt.Errorf("file not found: %d", distribution.FileID)
+	}
+
+	if parent.NodeID == app.Node.ID {
+		return parent, nil
+	}
+
+	if _, err := ResolvePath(app, parent.Dir, parent.File); err != nil {
+		return nil, fmt.Errorf("file path is not allowed: %s", parent.Path())
+	}
+
+	file := model2.NewFile()
+	res = app.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE parent_id = $1 AND node_id = $2",
+		file.TableName()),
+		file,
+		parent.ID,
+		app.Node.ID)
+	exists := res.Error == nil
+
+	if !BlobExists(app, distribution.Checksum) {
+		if err := download(app, distribution); err != nil {
+			return nil, err
+		}
+	}
+	if err := LinkBlob(app, distribution.Checksum, parent.Path()); err != nil {
+		return nil, err
+	}
+
+	file.NodeID = app.Node.ID
+	file.ParentID.SetValid(parent.ID)
+	file.JobID = parent.JobID
+	file.Dir = parent.Dir
+	file.File = parent.File
+	file.Type = app.Config.NodeType
+	file.Checksum.SetValid(distribution.Checksum)
+	file.Size.SetValid(distribution.Size)
+	file.Mime = parent.Mime
+
+	if exists {
+		_, err := app.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET checksum = $1, size = $2, mime = $3, "+
+			"updated_at = (CURRENT_TIMESTAMP at time zone 'utc') WHERE id = $4", file.TableName()),
+			file.Checksum,
+			file.Size,
+			file.Mime,
+			file.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := app.Database.Insert(new(model2.File), file, "id", "inserted_at", "updated_at"); err != nil {
+		return nil, err
+	}
+
+	log := model2.NewFileLog(parent.ID)
+	log.NodeID = app.Node.ID
+	log.Type = model.Distributing
+	log.Data = model2.FileLogData{
+		Dir:      file.Dir,
+		File:     file.File,
+		Type:     file.Type,
+		Checksum: distribution.Checksum,
+	}
+	if err := app.Database.Insert(new(model2.FileLog), log, "id"); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// download distributed file content to the blob store. Content is stored
+// only if its checksum is verified.
+func download(app *App, distribution *model.FileDistribution) error {
+	req, err := http.NewRequest(http.MethodGet, distribution.URL, nil)
+	if err != nil {
+		return err
+	}
+	if distribution.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+distribution.Token)
+	}
+
+	client := &http.Client{Timeout: FileFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("file could not be fetched: %s", resp.Status)
+	}
+
+	_, err = storeBlob(app, resp.Body, "", distribution.Checksum)
+	return err
+}
+
+// distribute fetch file of the distribution message received from the channel
+func distribute(app *App, message *model.ReceivedMessage) *JobResult {
+	result := &JobResult{
+		Code:      fmt.Sprintf("file:%d", message.Distribution.FileID),
+		StartedAt: time.Now().UTC(),
+	}
+
+	app.Logger.LogInfo(fmt.Sprintf("Receive file distribution: %d %s",
+		message.Distribution.FileID, message.Distribution.Checksum))
+
+	if _, err := FetchFile(app, message.Distribution); err != nil {
+		app.Logger.LogError(err, "file could not be distributed: "+result.Code)
+		result.ExitCode = -1
+		result.Error = err
+	}
+	result.FinishedAt = time.Now().UTC()
+
+	return result
+}
@@ -0,0 +1,87 @@
+package cmn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_FileChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "release.tar.gz")
+	ioutil.WriteFile(path, []byte("release"), 0644)
+
+	checksum, size, err := FileChecksum(path)
+	sum := sha256.Sum256([]byte("release"))
+	if err != nil || checksum != hex.EncodeToString(sum[:]) || size != 7 {
+		t.Fatalf("unexpected checksum: %s %d %v", checksum, size, err)
+	}
+
+	if _, _, err := FileChecksum(filepath.Join(dir, "none")); err == nil {
+		t.Fatal("checksum of missing file should fail")
+	}
+}
+
+func Test_DownloadDistributedFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("release"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &App{Config: &model.Config{LibPath: dir}, Logger: logger}
+
+	sum := sha256.Sum256([]byte("release"))
+	distribution := &model.FileDistribution{
+		FileID:   1,
+		URL:      server.URL,
+		Token:    "token",
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+
+	if err := download(app, distribution); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(BlobPath(app, distribution.Checksum)); err != nil || string(data) != "release" {
+		t.Fatalf("unexpected blob content: %s %v", data, err)
+	}
+
+	mismatch := *distribution
+	mismatch.Checksum = hex.EncodeToString(make([]byte, sha256.Size))
+	if err := download(app, &mismatch); err == nil {
+		t.Fatal("file with mismatched checksum should not be downloaded")
+	}
+	if BlobExists(app, mismatch.Checksum) {
+		t.Fatal("file with mismatched checksum should not be stored")
+	}
+
+	unauthorized := *distribution
+	unauthorized.Token = ""
+	if err := download(app, &unauthorized); err == nil {
+		t.Fatal("file should not be downloaded without token")
+	}
+
+	files, _ := ioutil.ReadDir(BlobDir(app))
+	if len(files) != 1 {
+		t.Fatalf("temporary files should be removed: %d", len(files))
+	}
+}
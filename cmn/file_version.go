@@ -0,0 +1,107 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/streetbyters/agente/database"
+	model2 "github.com/streetbyters/agente/database/model"
+	"io"
+	"io/ioutil"
+	"os"
+	"unicode/utf8"
+)
+
+// TextMaxSize max size of text content compared by file version diffs
+var TextMaxSize int64 = 1 << 20
+
+var (
+	// ErrNotText content is not utf-8 encoded text
+	ErrNotText = errors.New("content is not text")
+	// ErrTextTooLarge content exceeds TextMaxSize
+	ErrTextTooLarge = errors.New("content is too large")
+)
+
+// FileBlob blob of current content of the file. Content without a stored
+// blob is stored first, so it is kept when the file is overwritten. Nil blob
+// is returned if the file does not exist on disk.
+func FileBlob(app *App, file *model2.File) (*Blob, error) {
+	if file.Checksum.String != "" && BlobExists(app, file.Checksum.String) {
+		return OpenBlob(app, file.Checksum.String, file.File)
+	}
+
+	f, err := os.Open(file.Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		return nil, err
+	}
+
+	return StoreBlob(app, f, file.File)
+}
+
+// AddFileVersion record the version with the next version number of its
+// file. Database is the transaction in which the file row is locked, so
+// concurrent versions of the file are not numbered the same.
+func AddFileVersion(db *database.Database, version *model2.FileVersion) error {
+	query := fmt.Sprintf("SELECT COALESCE(MAX(version), 0) + 1 FROM %s WHERE file_id = $1", version.TableName())
+
+	var err error
+	if db.Tx != nil {
+		err = db.Tx.Get(&version.Version, query, version.FileID)
+	} else {
+		err = db.DB.Get(&version.Version, query, version.FileID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.Insert(new(model2.FileVersion), version, "id", "inserted_at")
+}
+
+// ReadText read utf-8 encoded text content of the blob
+func ReadText(app *App, checksum string) (string, error) {
+	f, err := os.Open(BlobPath(app, checksum))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, TextMaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > TextMaxSize {
+		return "", ErrTextTooLarge
+	}
+	if !utf8.Valid(data) {
+		return "", ErrNotText
+	}
+	for _, b := range data {
+		if b == 0 {
+			return "", ErrNotText
+		}
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,55 @@
+package cmn
+
+import (
+	"bytes"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_FileBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &App{Config: &model.Config{LibPath: dir}, Logger: logger}
+
+	file := model2.NewFile()
+	file.Dir = dir
+	file.File = "agente.txt"
+	if blob, err := FileBlob(app, file); blob != nil || err != nil {
+		t.Fatalf("missing file should not have a blob: %+v %v", blob, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "agente.txt"), []byte("agente\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := FileBlob(app, file)
+	if err != nil || blob == nil || !BlobExists(app, blob.Checksum) {
+		t.Fatalf("content should be stored as a blob: %+v %v", blob, err)
+	}
+
+	text, err := ReadText(app, blob.Checksum)
+	if err != nil || text != "agente\n" {
+		t.Fatalf("unexpected text: %q %v", text, err)
+	}
+
+	binary, err := StoreBlob(app, bytes.NewBufferString("\x00agente"), "agente.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadText(app, binary.Checksum); err != ErrNotText {
+		t.Fatalf("binary content should not be read as text: %v", err)
+	}
+
+	max := TextMaxSize
+	TextMaxSize = 3
+	defer func() { TextMaxSize = max }()
+	if _, err := ReadText(app, blob.Checksum); err != ErrTextTooLarge {
+		t.Fatalf("large content should not be read as text: %v", err)
+	}
+}
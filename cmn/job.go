@@ -17,10 +17,26 @@
 package cmn
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
 	"github.com/streetbyters/agente/model"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 )
 
+// DefaultJobShell shell used for job scripts if JOB_SHELL is not set
+const DefaultJobShell = "/bin/sh"
+
+// JobLogOutputLimit maximum stdout/stderr bytes kept in job logs
+const JobLogOutputLimit = 64 * 1024
+
 // Job structure
 type Job struct {
 	App    *App
@@ -28,14 +44,274 @@ type Job struct {
 	Detail interface{}
 }
 
+// JobResult job execution result
+type JobResult struct {
+	LogID      int64     `json:"log_id"`
+	Code       string    `json:"code"`
+	ExitCode   int       `json:"exit_code"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      error     `json:"-"`
+}
+
+// Success job execution state
+func (r *JobResult) Success() bool {
+	return r != nil && r.Error == nil && r.ExitCode == 0
+}
+
 // NewJob building job
 func NewJob(app *App) *Job {
 	return &Job{App: app}
 }
 
 // Run job with received message
-func (j Job) Run(message *model.ReceivedMessage) {
-	if message != nil {
-		fmt.Println(message)
+func (j Job) Run(message *model.ReceivedMessage) *JobResult {
+	if message == nil {
+		return nil
+	}
+
+	graph, err := j.Graph()
+	if err != nil {
+		j.App.Logger.LogError(err, "job graph could not be loaded: "+message.JobName)
+		return &JobResult{Code: message.JobName, ExitCode: -1, Error: err}
+	}
+
+	plan, err := graph.Plan(message.JobName)
+	if err != nil {
+		j.App.Logger.LogError(err, "job could not be planned: "+message.JobName)
+		return &JobResult{Code: message.JobName, ExitCode: -1, Error: err}
+	}
+
+	var result *JobResult
+	for _, detail := range plan {
+		result = j.Execute(detail)
+		j.Log(detail, result, message)
+
+		if !result.Success() {
+			j.App.Logger.LogError(result.Error, "job chain aborted: "+message.JobName+
+				" failed job: "+detail.Code)
+			break
+		}
+	}
+
+	return result
+}
+
+// Graph building job dependency graph with latest job details
+func (j Job) Graph() (*JobGraph, error) {
+	if j.App.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	detail := model2.NewJobDetail()
+	var details []model2.JobDetail
+	res := j.App.Database.QueryWithModel(fmt.Sprintf("SELECT d.* FROM %s AS d"+
+		" LEFT OUTER JOIN %s AS d2 ON d.job_id = d2.job_id AND d.id < d2.id"+
+		" WHERE d2.id IS NULL ORDER BY d.id ASC", detail.TableName(), detail.TableName()),
+		&details)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	var rDetails []*model2.JobDetail
+	for i := range details {
+		rDetails = append(rDetails, &details[i])
+	}
+
+	return NewJobGraph(rDetails...), nil
+}
+
+// Log write job execution result to job logs
+func (j Job) Log(detail *model2.JobDetail, result *JobResult, message *model.ReceivedMessage) *model2.JobLog {
+	if j.App.Database == nil || j.App.Node == nil {
+		return nil
+	}
+
+	log := model2.NewJobLog(detail.JobID)
+	log.NodeID = j.App.Node.ID
+	log.State = result.Success()
+	log.Data = model2.JobLogData{
+		Code:       detail.Code,
+		Type:       detail.Type,
+		StartedAt:  result.StartedAt,
+		FinishedAt: result.FinishedAt,
+		ExitCode:   result.ExitCode,
+		Stdout:     truncateOutput(result.Stdout),
+		Stderr:     truncateOutput(result.Stderr),
+		Message:    message,
+	}
+	if result.Error != nil {
+		log.Data.Error = result.Error.Error()
+	}
+
+	if err := j.App.Database.Insert(new(model2.JobLog), log, "id", "inserted_at"); err != nil {
+		j.App.Logger.LogError(err, "job log could not be created: "+detail.Code)
+		return nil
+	}
+	result.LogID = log.ID
+
+	return log
+}
+
+// Find latest job detail with given code
+func (j Job) Find(code string) (*model2.JobDetail, error) {
+	if j.App.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	detail := model2.NewJobDetail()
+	res := j.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s "+
+		"WHERE code = $1 ORDER BY id DESC LIMIT 1", detail.TableName()),
+		detail,
+		code)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	return detail, nil
+}
+
+// Execute job detail with the handler of its job type
+func (j Job) Execute(detail *model2.JobDetail) *JobResult {
+	j.App.Logger.LogInfo("Running job: " + detail.Code)
+
+	result := j.Handler(detail.Type).Handle(detail)
+
+	j.App.Logger.LogInfo("Finished job: " + detail.Code +
+		" exit code: " + strconv.Itoa(result.ExitCode))
+
+	return result
+}
+
+// Script run job detail script in given directory with configured shell,
+// environment and timeout
+func (j Job) Script(detail *model2.JobDetail, dir string) *JobResult {
+	result := &JobResult{Code: detail.Code, StartedAt: time.Now().UTC()}
+
+	defer func() {
+		result.FinishedAt = time.Now().UTC()
+	}()
+
+	cmd, ctx, cancel, err := j.command(detail, dir, j.App.Config.JobTimeout)
+	if err != nil {
+		result.ExitCode = -1
+		result.Error = err
+		j.App.Logger.LogError(err, "job could not be started: "+detail.Code)
+		return result
 	}
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = run(ctx, cmd)
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok || result.ExitCode < 0 {
+			result.ExitCode = -1
+			result.Error = err
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result.ExitCode = -1
+		result.Error = errors.New("job timed out")
+	}
+
+	return result
+}
+
+// command build job command with configured shell. Command runs in its own
+// process group, so the whole group is killed when the job times out.
+func (j Job) command(detail *model2.JobDetail, dir string, timeout int) (*exec.Cmd, context.Context, context.CancelFunc, error) {
+	shell := j.App.Config.JobShell
+	if shell == "" {
+		shell = DefaultJobShell
+	}
+
+	var args []string
+	switch {
+	case detail.Script.String != "":
+		args = []string{"-c", detail.Script.String}
+	case detail.ScriptFile.String != "":
+		args = []string{j.ScriptFile(detail)}
+	default:
+		return nil, nil, nil, errors.New("job has no script or script file")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, nil, err
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	}
+
+	cmd := exec.Command(shell, args...)
+	cmd.Dir = dir
+	setProcessGroup(cmd)
+	cmd.Env = append(os.Environ(), j.App.Config.JobEnv...)
+	cmd.Env = append(cmd.Env,
+		"AGENTE_JOB_CODE="+detail.Code,
+		"AGENTE_JOB_TYPE="+string(detail.Type),
+		"AGENTE_NODE="+j.App.Config.NodeName,
+		"AGENTE_LIB_PATH="+j.App.Config.LibPath,
+	)
+
+	return cmd, ctx, cancel, nil
+}
+
+// run start command and wait for it. Process group of the command is killed
+// when the context is done, so children holding the output of the command
+// do not keep it running after the timeout.
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		signalProcess(cmd.Process.Pid, syscall.SIGKILL)
+		return <-done
+	}
+}
+
+// WorkDir job working directory in lib path
+func (j Job) WorkDir(detail *model2.JobDetail) string {
+	return filepath.Join(j.App.Config.LibPath, "jobs", detail.Code)
+}
+
+// ScriptFile path of job detail script file. Relative paths are resolved
+// in lib path.
+func (j Job) ScriptFile(detail *model2.JobDetail) string {
+	if detail.ScriptFile.String == "" || filepath.IsAbs(detail.ScriptFile.String) {
+		return detail.ScriptFile.String
+	}
+	return filepath.Join(j.App.Config.LibPath, detail.ScriptFile.String)
+}
+
+// truncateOutput keep last bytes of job output for job logs
+func truncateOutput(output string) string {
+	if len(output) <= JobLogOutputLimit {
+		return output
+	}
+
+	return "..." + output[len(output)-JobLogOutputLimit:]
 }
@@ -0,0 +1,218 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"errors"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/utils"
+	"strings"
+)
+
+// JobGraph before/after job dependency graph. An edge is created from
+// every before job to the job and from the job to every after job.
+type JobGraph struct {
+	Details map[string]*model2.JobDetail
+}
+
+// CycleError dependency cycle error with offending path
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// NewJobGraph building job dependency graph. Latter details override
+// former details with the same code.
+func NewJobGraph(details ...*model2.JobDetail) *JobGraph {
+	g := &JobGraph{Details: make(map[string]*model2.JobDetail)}
+	for _, d := range details {
+		g.Details[d.Code] = d
+	}
+
+	return g
+}
+
+// BeforeJobs job codes that must run before the given job detail
+func BeforeJobs(detail *model2.JobDetail) []string {
+	if !detail.Before {
+		return nil
+	}
+
+	return parseJobCodes(detail.BeforeJobs.String)
+}
+
+// AfterJobs job codes that must run after the given job detail
+func AfterJobs(detail *model2.JobDetail) []string {
+	if !detail.After {
+		return nil
+	}
+
+	return parseJobCodes(detail.AfterJobs.String)
+}
+
+func parseJobCodes(str string) []string {
+	var codes []string
+	for _, code := range strings.Split(str, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	return codes
+}
+
+// Plan ordered job details to run for the given job code. Before jobs,
+// the job itself and after jobs are resolved recursively and sorted
+// topologically.
+func (g *JobGraph) Plan(code string) ([]*model2.JobDetail, error) {
+	nodes, err := g.closure(code, true)
+	if err != nil {
+		return nil, err
+	}
+
+	order, path := g.sort(code, nodes)
+	if path != nil {
+		return nil, &CycleError{Path: path}
+	}
+
+	var plan []*model2.JobDetail
+	for _, c := range order {
+		plan = append(plan, g.Details[c])
+	}
+
+	return plan, nil
+}
+
+// Cycle dependency cycle path reachable from the given job code. Missing
+// job codes are ignored so that jobs can be defined in any order.
+func (g *JobGraph) Cycle(code string) []string {
+	nodes, _ := g.closure(code, false)
+	_, path := g.sort(code, nodes)
+
+	return path
+}
+
+// closure job codes reachable from the given code in discovery order
+func (g *JobGraph) closure(code string, strict bool) ([]string, error) {
+	var nodes []string
+	seen := map[string]bool{code: true}
+	queue := []string{code}
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		detail, ok := g.Details[c]
+		if !ok {
+			if strict {
+				return nil, errors.New("job not found: " + c)
+			}
+			continue
+		}
+		nodes = append(nodes, c)
+
+		for _, next := range append(BeforeJobs(detail), AfterJobs(detail)...) {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return nodes, nil
+}
+
+// sort topological order of given job codes. If a cycle is found the
+// offending path is returned in execution direction.
+func (g *JobGraph) sort(code string, nodes []string) ([]string, []string) {
+	in := make(map[string]bool)
+	for _, n := range nodes {
+		in[n] = true
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var order, stack, cycle []string
+
+	var visit func(n string) bool
+	visit = func(n string) bool {
+		switch state[n] {
+		case visited:
+			return true
+		case visiting:
+			for i, s := range stack {
+				if s == n {
+					cycle = append([]string{}, stack[i:]...)
+					cycle = append(cycle, n)
+					break
+				}
+			}
+			for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+				cycle[i], cycle[j] = cycle[j], cycle[i]
+			}
+			return false
+		}
+
+		state[n] = visiting
+		stack = append(stack, n)
+		for _, p := range g.predecessors(n, nodes, in) {
+			if !visit(p) {
+				return false
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = visited
+		order = append(order, n)
+
+		return true
+	}
+
+	if in[code] && !visit(code) {
+		return nil, cycle
+	}
+	for _, n := range nodes {
+		if !visit(n) {
+			return nil, cycle
+		}
+	}
+
+	return order, nil
+}
+
+// predecessors job codes that must run before the given job code
+func (g *JobGraph) predecessors(code string, nodes []string, in map[string]bool) []string {
+	var preds []string
+	for _, b := range BeforeJobs(g.Details[code]) {
+		if in[b] {
+			preds = append(preds, b)
+		}
+	}
+
+	for _, n := range nodes {
+		if ok, _ := utils.InArray(code, AfterJobs(g.Details[n])); ok {
+			preds = append(preds, n)
+		}
+	}
+
+	return preds
+}
@@ -0,0 +1,135 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/database/model"
+	"reflect"
+	"testing"
+)
+
+func newGraphDetail(code string, before string, after string) *model.JobDetail {
+	detail := model.NewJobDetail()
+	detail.Code = code
+	if before != "" {
+		detail.Before = true
+		detail.BeforeJobs.SetValid(before)
+	}
+	if after != "" {
+		detail.After = true
+		detail.AfterJobs.SetValid(after)
+	}
+
+	return detail
+}
+
+func planCodes(plan []*model.JobDetail) []string {
+	var codes []string
+	for _, d := range plan {
+		codes = append(codes, d.Code)
+	}
+
+	return codes
+}
+
+func Test_JobGraphPlan(t *testing.T) {
+	graph := NewJobGraph(
+		newGraphDetail("stop", "", ""),
+		newGraphDetail("deploy", "stop", "migrate, start"),
+		newGraphDetail("migrate", "", ""),
+		newGraphDetail("start", "migrate", ""),
+	)
+
+	plan, err := graph.Plan("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if codes := planCodes(plan); !reflect.DeepEqual(codes, []string{"stop", "deploy", "migrate", "start"}) {
+		t.Fatalf("unexpected plan: %v", codes)
+	}
+
+	plan, err = graph.Plan("stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if codes := planCodes(plan); !reflect.DeepEqual(codes, []string{"stop"}) {
+		t.Fatalf("unexpected plan: %v", codes)
+	}
+}
+
+func Test_JobGraphPlanWithNestedJobs(t *testing.T) {
+	graph := NewJobGraph(
+		newGraphDetail("backup", "", ""),
+		newGraphDetail("stop", "backup", ""),
+		newGraphDetail("deploy", "stop", "start"),
+		newGraphDetail("start", "", "notify"),
+		newGraphDetail("notify", "", ""),
+	)
+
+	plan, err := graph.Plan("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if codes := planCodes(plan); !reflect.DeepEqual(codes, []string{"backup", "stop", "deploy", "start", "notify"}) {
+		t.Fatalf("unexpected plan: %v", codes)
+	}
+}
+
+func Test_JobGraphPlanIgnoresDisabledDependencies(t *testing.T) {
+	deploy := newGraphDetail("deploy", "stop", "start")
+	deploy.Before = false
+	graph := NewJobGraph(deploy, newGraphDetail("start", "", ""))
+
+	plan, err := graph.Plan("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if codes := planCodes(plan); !reflect.DeepEqual(codes, []string{"deploy", "start"}) {
+		t.Fatalf("unexpected plan: %v", codes)
+	}
+}
+
+func Test_JobGraphPlanWithMissingJob(t *testing.T) {
+	graph := NewJobGraph(newGraphDetail("deploy", "stop", ""))
+
+	if _, err := graph.Plan("deploy"); err == nil {
+		t.Fatal("plan should be failed if a dependency is missing")
+	}
+
+	if path := graph.Cycle("deploy"); path != nil {
+		t.Fatalf("unexpected cycle: %v", path)
+	}
+}
+
+func Test_JobGraphCycle(t *testing.T) {
+	graph := NewJobGraph(
+		newGraphDetail("a", "c", ""),
+		newGraphDetail("b", "a", ""),
+		newGraphDetail("c", "b", ""),
+	)
+
+	path := graph.Cycle("a")
+	if !reflect.DeepEqual(path, []string{"a", "b", "c", "a"}) {
+		t.Fatalf("unexpected cycle: %v", path)
+	}
+
+	_, err := graph.Plan("a")
+	if _, ok := err.(*CycleError); !ok {
+		t.Fatalf("plan should be failed with cycle error: %v", err)
+	}
+
+	graph = NewJobGraph(newGraphDetail("self", "self", ""))
+	if path := graph.Cycle("self"); !reflect.DeepEqual(path, []string{"self", "self"}) {
+		t.Fatalf("unexpected cycle: %v", path)
+	}
+
+	graph = NewJobGraph(
+		newGraphDetail("deploy", "", "start"),
+		newGraphDetail("start", "", "deploy"),
+	)
+	if path := graph.Cycle("deploy"); !reflect.DeepEqual(path, []string{"deploy", "start", "deploy"}) {
+		t.Fatalf("unexpected cycle: %v", path)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+)
+
+// JobHandler job type handler interface
+type JobHandler interface {
+	Handle(detail *model2.JobDetail) *JobResult
+}
+
+// Handlers All defined job type handlers
+func (j Job) Handlers() map[model.JobType]JobHandler {
+	handlers := make(map[model.JobType]JobHandler)
+
+	process := &JobProcess{Job: j}
+	handlers[model.NewRelease] = &JobRelease{Job: j}
+	handlers[model.Start] = process
+	handlers[model.Restart] = process
+	handlers[model.Shutdown] = process
+	handlers[model.Other] = &JobScript{Job: j}
+
+	return handlers
+}
+
+// Handler job type handler. Unknown job types are run as plain scripts.
+func (j Job) Handler(typ model.JobType) JobHandler {
+	if handler, ok := j.Handlers()[typ]; ok {
+		return handler
+	}
+
+	return &JobScript{Job: j}
+}
+
+// JobScript plain script job handler
+type JobScript struct {
+	Job
+}
+
+// Handle run job script in job working directory
+func (h *JobScript) Handle(detail *model2.JobDetail) *JobResult {
+	return h.Script(detail, h.WorkDir(detail))
+}
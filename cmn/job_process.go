@@ -0,0 +1,215 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultJobGracePeriod seconds to wait for a process to stop if
+// JOB_GRACE_PERIOD is not set
+const DefaultJobGracePeriod = 10
+
+// JobProcess start, shutdown and restart job handler. The job script of
+// start and restart jobs is run as a long-running process and should stay
+// in the foreground (e.g. exec ./server).
+type JobProcess struct {
+	Job
+}
+
+// Handle manage job detail process by job type
+func (h *JobProcess) Handle(detail *model2.JobDetail) *JobResult {
+	switch detail.Type {
+	case model.Shutdown:
+		return h.Shutdown(detail)
+	case model.Restart:
+		result := h.Stop(detail)
+		if !result.Success() {
+			return result
+		}
+
+		start := h.Start(detail)
+		start.StartedAt = result.StartedAt
+		start.Stdout = result.Stdout + start.Stdout
+
+		return start
+	default:
+		return h.Start(detail)
+	}
+}
+
+// Start run job script as a background process and write its pid file
+func (h *JobProcess) Start(detail *model2.JobDetail) *JobResult {
+	result := &JobResult{Code: detail.Code, StartedAt: time.Now().UTC()}
+
+	fail := func(err error) *JobResult {
+		h.App.Logger.LogError(err, "process could not be started: "+detail.ProcessName())
+		result.ExitCode = -1
+		result.Error = err
+		result.FinishedAt = time.Now().UTC()
+		return result
+	}
+
+	if pid, ok := h.Pid(detail); ok && processAlive(pid) {
+		return fail(fmt.Errorf("process is already running: %s pid %d", detail.ProcessName(), pid))
+	}
+
+	if err := os.MkdirAll(h.RunDir(), 0755); err != nil {
+		return fail(err)
+	}
+
+	cmd, _, _, err := h.command(detail, h.CurrentDir(detail), 0)
+	if err != nil {
+		return fail(err)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(h.RunDir(), detail.ProcessName()+".log"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fail(err)
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return fail(err)
+	}
+
+	pid := cmd.Process.Pid
+	pidFile := h.PidFile(detail)
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		logFile.Close()
+		return fail(err)
+	}
+
+	go func() {
+		cmd.Wait()
+		logFile.Close()
+		if p, ok := h.Pid(detail); ok && p == pid {
+			os.Remove(pidFile)
+		}
+		h.App.Logger.LogInfo(fmt.Sprintf("Process exited: %s pid %d", detail.ProcessName(), pid))
+	}()
+
+	result.Stdout = fmt.Sprintf("started %s pid %d\n", detail.ProcessName(), pid)
+	result.FinishedAt = time.Now().UTC()
+
+	return result
+}
+
+// Shutdown run job script as the stop command if there is one and stop
+// the process if it is still alive
+func (h *JobProcess) Shutdown(detail *model2.JobDetail) *JobResult {
+	if detail.Script.String == "" && detail.ScriptFile.String == "" {
+		return h.Stop(detail)
+	}
+
+	result := h.Script(detail, h.CurrentDir(detail))
+	if !result.Success() {
+		return result
+	}
+
+	stop := h.Stop(detail)
+	stop.StartedAt = result.StartedAt
+	stop.Stdout = result.Stdout + stop.Stdout
+	stop.Stderr = result.Stderr + stop.Stderr
+
+	return stop
+}
+
+// Stop send SIGTERM to the process, wait grace period and kill it if it
+// is still alive
+func (h *JobProcess) Stop(detail *model2.JobDetail) *JobResult {
+	result := &JobResult{Code: detail.Code, StartedAt: time.Now().UTC()}
+	defer func() {
+		result.FinishedAt = time.Now().UTC()
+	}()
+
+	pid, ok := h.Pid(detail)
+	if !ok || !processAlive(pid) {
+		os.Remove(h.PidFile(detail))
+		result.Stdout = fmt.Sprintf("process is not running %s\n", detail.ProcessName())
+		return result
+	}
+
+	if err := signalProcess(pid, syscall.SIGTERM); err != nil {
+		result.ExitCode = -1
+		result.Error = err
+		return result
+	}
+
+	grace := h.App.Config.JobGrace
+	if grace <= 0 {
+		grace = DefaultJobGracePeriod
+	}
+
+	deadline := time.Now().Add(time.Duration(grace) * time.Second)
+	for processAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if processAlive(pid) {
+		if err := signalProcess(pid, syscall.SIGKILL); err != nil {
+			result.ExitCode = -1
+			result.Error = err
+			return result
+		}
+		result.Stdout = fmt.Sprintf("killed %s pid %d\n", detail.ProcessName(), pid)
+	} else {
+		result.Stdout = fmt.Sprintf("stopped %s pid %d\n", detail.ProcessName(), pid)
+	}
+
+	os.Remove(h.PidFile(detail))
+
+	return result
+}
+
+// Pid process id in job detail pid file. Init and process group ids of
+// signals are not valid pids.
+func (h *JobProcess) Pid(detail *model2.JobDetail) (int, bool) {
+	data, err := ioutil.ReadFile(h.PidFile(detail))
+	if err != nil {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 1 {
+		return 0, false
+	}
+
+	return pid, true
+}
+
+// RunDir pid and process log directory in lib path
+func (h *JobProcess) RunDir() string {
+	return filepath.Join(h.App.Config.LibPath, "run")
+}
+
+// PidFile pid file of job detail process
+func (h *JobProcess) PidFile(detail *model2.JobDetail) string {
+	return filepath.Join(h.RunDir(), detail.ProcessName()+".pid")
+}
@@ -0,0 +1,129 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_JobProcessStartAndShutdown(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+	app.Config.JobGrace = 2
+
+	start := model.NewJobDetail()
+	start.Code = "app_start"
+	start.Type = model2.Start
+	start.Process.SetValid("app")
+	start.Script.SetValid("exec sleep 30")
+
+	result := app.Job.Execute(start)
+	if !result.Success() {
+		t.Fatal(result.Error)
+	}
+
+	handler := &JobProcess{Job: *app.Job}
+	pid, ok := handler.Pid(start)
+	if !ok || !processAlive(pid) {
+		t.Fatal("process should be running")
+	}
+
+	result = app.Job.Execute(start)
+	if result.Success() {
+		t.Fatal("process should not be started twice")
+	}
+
+	restart := model.NewJobDetail()
+	restart.Code = "app_restart"
+	restart.Type = model2.Restart
+	restart.Process.SetValid("app")
+	restart.Script.SetValid("exec sleep 30")
+
+	result = app.Job.Execute(restart)
+	if !result.Success() {
+		t.Fatal(result.Error)
+	}
+
+	newPid, ok := handler.Pid(start)
+	if !ok || newPid == pid || processAlive(pid) {
+		t.Fatal("process should be restarted")
+	}
+
+	shutdown := model.NewJobDetail()
+	shutdown.Code = "app_shutdown"
+	shutdown.Type = model2.Shutdown
+	shutdown.Process.SetValid("app")
+
+	result = app.Job.Execute(shutdown)
+	if !result.Success() || !strings.HasPrefix(result.Stdout, "stopped app") {
+		t.Fatal(result.Error, result.Stdout)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if processAlive(newPid) {
+		t.Fatal("process should be stopped")
+	}
+
+	if _, ok := handler.Pid(start); ok {
+		t.Fatal("pid file should be removed")
+	}
+
+	result = app.Job.Execute(shutdown)
+	if !result.Success() {
+		t.Fatal("shutdown should be success if process is not running")
+	}
+}
+
+func Test_JobProcessKillAfterGracePeriod(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+	app.Config.JobGrace = 1
+
+	start := model.NewJobDetail()
+	start.Code = "stubborn"
+	start.Type = model2.Start
+	start.Script.SetValid("trap '' TERM; while true; do sleep 1; done")
+
+	result := app.Job.Execute(start)
+	if !result.Success() {
+		t.Fatal(result.Error)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	shutdown := model.NewJobDetail()
+	shutdown.Code = "stubborn_shutdown"
+	shutdown.Type = model2.Shutdown
+	shutdown.Process.SetValid("stubborn")
+
+	result = app.Job.Execute(shutdown)
+	if !result.Success() || !strings.HasPrefix(result.Stdout, "killed stubborn") {
+		t.Fatal(result.Error, result.Stdout)
+	}
+}
+
+func Test_JobProcessPidFile(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	detail := model.NewJobDetail()
+	detail.Code = "app_start"
+	detail.Process.SetValid("app")
+
+	handler := &JobProcess{Job: *app.Job}
+	os.MkdirAll(handler.RunDir(), os.ModePerm)
+	for _, data := range []string{"", "abc", "-1", "0", "1"} {
+		ioutil.WriteFile(handler.PidFile(detail), []byte(data), 0644)
+		if pid, ok := handler.Pid(detail); ok {
+			t.Fatalf("pid file %q should not be valid: %d", data, pid)
+		}
+	}
+
+	ioutil.WriteFile(handler.PidFile(detail), []byte("4242\n"), 0644)
+	if pid, ok := handler.Pid(detail); !ok || pid != 4242 {
+		t.Fatalf("unexpected pid: %d", pid)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup run command in its own process group so that signals
+// reach every child of the job script
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcess send signal to the process group of given pid
+func signalProcess(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pid, sig); err != nil {
+		return syscall.Kill(pid, sig)
+	}
+
+	return nil
+}
+
+// processAlive check whether a process with given pid exists
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
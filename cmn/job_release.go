@@ -0,0 +1,453 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"github.com/streetbyters/agente/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CurrentRelease name of the symlink pointing to the active release
+const CurrentRelease = "current"
+
+// ReleaseTimeFormat release directory name format if versioning is enabled
+const ReleaseTimeFormat = "20060102150405"
+
+// DefaultVersionKeep number of releases kept if VERSIONING_KEEP is not set
+const DefaultVersionKeep = 5
+
+// JobRelease new release job handler
+type JobRelease struct {
+	Job
+}
+
+// Handle unpack the job artifact into a release directory, run the job
+// script in it and switch the current release symlink
+func (h *JobRelease) Handle(detail *model2.JobDetail) *JobResult {
+	result := &JobResult{Code: detail.Code, StartedAt: time.Now().UTC()}
+
+	fail := func(err error) *JobResult {
+		h.App.Logger.LogError(err, "release could not be created: "+detail.Code)
+		result.ExitCode = -1
+		result.Error = err
+		result.FinishedAt = time.Now().UTC()
+		return result
+	}
+
+	file, err := h.Artifact(detail)
+	if err != nil {
+		return fail(err)
+	}
+
+	dir, err := h.newRelease(detail)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := Unpack(file.Path(), dir); err != nil {
+		return fail(err)
+	}
+
+	if detail.Script.String != "" || detail.ScriptFile.String != "" {
+		result = h.Script(detail, dir)
+		if !result.Success() {
+			return result
+		}
+	}
+
+	if err := SwitchRelease(h.ReleaseDir(detail), dir); err != nil {
+		return fail(err)
+	}
+
+	if h.App.Config.Versioning {
+		removed, err := PruneReleases(h.ReleaseDir(detail), h.App.Config.VersionKeep)
+		if err != nil {
+			h.App.Logger.LogError(err, "old releases could not be removed: "+detail.Code)
+		}
+		for _, r := range removed {
+			result.Stdout += fmt.Sprintf("removed release %s\n", r)
+		}
+	}
+
+	result.Stdout += fmt.Sprintf("released %s\n", dir)
+	result.FinishedAt = time.Now().UTC()
+
+	return result
+}
+
+// newRelease create the directory of the new release. Every release gets a
+// timestamped directory if versioning is enabled, otherwise the single
+// release directory is replaced.
+func (h *JobRelease) newRelease(detail *model2.JobDetail) (string, error) {
+	if !h.App.Config.Versioning {
+		dir := filepath.Join(h.ReleaseDir(detail), "release")
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+
+		return dir, os.MkdirAll(dir, 0755)
+	}
+
+	if err := os.MkdirAll(h.ReleaseDir(detail), 0755); err != nil {
+		return "", err
+	}
+
+	name := time.Now().UTC().Format(ReleaseTimeFormat)
+	dir := filepath.Join(h.ReleaseDir(detail), name)
+	for i := 1; ; i++ {
+		if err := os.Mkdir(dir, 0755); err == nil {
+			return dir, nil
+		} else if !os.IsExist(err) {
+			return "", err
+		}
+		dir = filepath.Join(h.ReleaseDir(detail), fmt.Sprintf("%s_%d", name, i))
+	}
+}
+
+// Rollback point the current release of job detail to the previous release
+// and run restart jobs defined in its after jobs. Release is not rolled back
+// if there is no restart job, because the running process would keep using
+// the current release.
+func (j Job) Rollback(detail *model2.JobDetail) (string, []*JobResult, error) {
+	if !j.App.Config.Versioning {
+		return "", nil, errors.New("versioning is not enabled")
+	}
+
+	if detail.Type != model.NewRelease {
+		return "", nil, errors.New("only new release jobs can be rolled back")
+	}
+
+	hooks, err := j.restartJobs(detail)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(hooks) == 0 {
+		return "", nil, errors.New("no restart job is defined in after jobs: " + detail.Code)
+	}
+
+	release, err := RollbackRelease(j.ReleaseDir(detail))
+	if err != nil {
+		return "", nil, err
+	}
+	j.App.Logger.LogInfo("Rolled back " + detail.Code + " to release " + release)
+
+	var results []*JobResult
+	for _, hook := range hooks {
+		result := j.Execute(hook)
+		j.Log(hook, result, &model.ReceivedMessage{JobName: hook.Code, Type: hook.Type})
+		results = append(results, result)
+		if !result.Success() {
+			return release, results, errors.New("restart job failed: " + hook.Code)
+		}
+	}
+
+	return release, results, nil
+}
+
+// restartJobs restart jobs defined in after jobs of job detail
+func (j Job) restartJobs(detail *model2.JobDetail) ([]*model2.JobDetail, error) {
+	codes := AfterJobs(detail)
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	graph, err := j.Graph()
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []*model2.JobDetail
+	for _, code := range codes {
+		if hook, ok := graph.Details[code]; ok && hook.Type == model.Restart {
+			hooks = append(hooks, hook)
+		}
+	}
+
+	return hooks, nil
+}
+
+// Releases release names in given release directory from oldest to newest
+func Releases(releaseDir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(releaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []string
+	for _, info := range infos {
+		if info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+			releases = append(releases, info.Name())
+		}
+	}
+	sort.Strings(releases)
+
+	return releases, nil
+}
+
+// PruneReleases remove oldest releases in given release directory and keep
+// the given number of releases. Current release is never removed.
+func PruneReleases(releaseDir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		keep = DefaultVersionKeep
+	}
+
+	releases, err := Releases(releaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := os.Readlink(filepath.Join(releaseDir, CurrentRelease))
+
+	var removed []string
+	for i := 0; i < len(releases)-keep; i++ {
+		if releases[i] == current {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(releaseDir, releases[i])); err != nil {
+			return removed, err
+		}
+		removed = append(removed, releases[i])
+	}
+
+	return removed, nil
+}
+
+// RollbackRelease atomically point the current release symlink to the
+// release before the current one
+func RollbackRelease(releaseDir string) (string, error) {
+	releases, err := Releases(releaseDir)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := os.Readlink(filepath.Join(releaseDir, CurrentRelease))
+	if err != nil {
+		return "", errors.New("there is no current release")
+	}
+
+	_, i := utils.InArray(current, releases)
+	if i <= 0 {
+		return "", errors.New("there is no previous release")
+	}
+
+	previous := releases[i-1]
+
+	return previous, SwitchRelease(releaseDir, filepath.Join(releaseDir, previous))
+}
+
+// Artifact latest file of the job to be released
+func (h *JobRelease) Artifact(detail *model2.JobDetail) (*model2.File, error) {
+	if h.App.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	file := model2.NewFile()
+	res := h.App.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s "+
+		"WHERE job_id = $1 ORDER BY id DESC LIMIT 1", file.TableName()),
+		file,
+		detail.JobID)
+	if res.Error != nil {
+		return nil, errors.New("release artifact not found for job: " + detail.Code)
+	}
+
+	return file, nil
+}
+
+// ReleaseDir release directory of job detail process in lib path
+func (j Job) ReleaseDir(detail *model2.JobDetail) string {
+	return filepath.Join(j.App.Config.LibPath, "releases", detail.ProcessName())
+}
+
+// CurrentDir active release directory of job detail process. Job working
+// directory is returned if there is no release yet.
+func (j Job) CurrentDir(detail *model2.JobDetail) string {
+	current := filepath.Join(j.ReleaseDir(detail), CurrentRelease)
+	if info, err := os.Stat(current); err == nil && info.IsDir() {
+		return current
+	}
+
+	return j.WorkDir(detail)
+}
+
+// SwitchRelease atomically point the current release symlink in given
+// release directory to the given release
+func SwitchRelease(releaseDir string, release string) error {
+	current := filepath.Join(releaseDir, CurrentRelease)
+	tmp := current + ".tmp"
+
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Symlink(filepath.Base(release), tmp); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, current)
+}
+
+// Unpack extract tar, tar.gz and zip archives into given directory. Other
+// files are copied as they are.
+func Unpack(src string, dir string) error {
+	name := strings.ToLower(src)
+
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		return untar(gz, dir)
+	case strings.HasSuffix(name, ".tar"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return untar(f, dir)
+	case strings.HasSuffix(name, ".zip"):
+		return unzip(src, dir)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(dir, filepath.Base(src)), f, info.Mode())
+}
+
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := archivePath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFile(target, tr, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func unzip(src string, dir string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		target, err := archivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, r, f.Mode())
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archivePath archive entry path in given directory. Entries escaping the
+// directory are rejected.
+func archivePath(dir string, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	if target != filepath.Clean(dir) &&
+		!strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", errors.New("illegal archive entry: " + name)
+	}
+
+	return target, nil
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,175 @@
+package cmn
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(body)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	gz.Close()
+}
+
+func Test_UnpackAndSwitchRelease(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	archive := filepath.Join(app.Config.LibPath, "app.tar.gz")
+	writeTestArchive(t, archive, map[string]string{
+		"bin/app":    "#!/bin/sh",
+		"config.env": "PORT=3000",
+	})
+
+	releaseDir := filepath.Join(app.Config.LibPath, "releases", "app")
+	release := filepath.Join(releaseDir, "release")
+	if err := Unpack(archive, release); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SwitchRelease(releaseDir, release); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(releaseDir, CurrentRelease, "config.env"))
+	if err != nil || string(data) != "PORT=3000" {
+		t.Fatal("current release should point to unpacked release", err)
+	}
+
+	second := filepath.Join(releaseDir, "second")
+	if err := Unpack(archive, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := SwitchRelease(releaseDir, second); err != nil {
+		t.Fatal(err)
+	}
+
+	target, _ := os.Readlink(filepath.Join(releaseDir, CurrentRelease))
+	if target != "second" {
+		t.Fatalf("current release: %s", target)
+	}
+}
+
+func Test_UnpackRejectsPathTraversal(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	archive := filepath.Join(app.Config.LibPath, "evil.tar.gz")
+	writeTestArchive(t, archive, map[string]string{
+		"../../evil.sh": "rm -rf /",
+	})
+
+	if err := Unpack(archive, filepath.Join(app.Config.LibPath, "release")); err == nil {
+		t.Fatal("archive entries escaping release directory should be rejected")
+	}
+}
+
+func Test_UnpackPlainFile(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	file := filepath.Join(app.Config.LibPath, "app.jar")
+	ioutil.WriteFile(file, []byte("jar"), 0644)
+
+	release := filepath.Join(app.Config.LibPath, "release")
+	if err := Unpack(file, release); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(release, "app.jar")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_PruneAndRollbackRelease(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	releaseDir := filepath.Join(app.Config.LibPath, "releases", "app")
+	for _, r := range []string{"20200101000000", "20200102000000", "20200103000000", "20200104000000"} {
+		os.MkdirAll(filepath.Join(releaseDir, r), 0755)
+	}
+	if err := SwitchRelease(releaseDir, filepath.Join(releaseDir, "20200101000000")); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := PruneReleases(releaseDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{"20200102000000"}) {
+		t.Fatalf("current release should never be pruned: %v", removed)
+	}
+
+	if _, err := RollbackRelease(releaseDir); err == nil {
+		t.Fatal("oldest release should not be rolled back")
+	}
+
+	SwitchRelease(releaseDir, filepath.Join(releaseDir, "20200104000000"))
+	release, err := RollbackRelease(releaseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release != "20200103000000" {
+		t.Fatalf("rolled back release: %s", release)
+	}
+
+	target, _ := os.Readlink(filepath.Join(releaseDir, CurrentRelease))
+	if target != release {
+		t.Fatalf("current release: %s", target)
+	}
+}
+
+func Test_JobRollback(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	detail := model2.NewJobDetail()
+	detail.Code = "app"
+	detail.Type = model.NewRelease
+
+	if _, _, err := app.Job.Rollback(detail); err == nil {
+		t.Fatal("rollback should be failed if versioning is not enabled")
+	}
+
+	app.Config.Versioning = true
+	releaseDir := app.Job.ReleaseDir(detail)
+	os.MkdirAll(filepath.Join(releaseDir, "20200101000000"), 0755)
+	os.MkdirAll(filepath.Join(releaseDir, "20200102000000"), 0755)
+	SwitchRelease(releaseDir, filepath.Join(releaseDir, "20200102000000"))
+
+	if _, _, err := app.Job.Rollback(detail); err == nil {
+		t.Fatal("rollback should be failed if there is no restart job")
+	}
+
+	target, _ := os.Readlink(filepath.Join(releaseDir, CurrentRelease))
+	if target != "20200102000000" {
+		t.Fatalf("release should not be rolled back without restart job: %s", target)
+	}
+}
@@ -0,0 +1,142 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/database/model"
+	model2 "github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newJobTestApp(t *testing.T, timeout int) (*App, func()) {
+	libPath, err := ioutil.TempDir("", "agente_job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{
+		Config: &model2.Config{
+			Mode:       model2.Test,
+			LibPath:    libPath,
+			JobTimeout: timeout,
+			JobEnv:     []string{"AGENTE_TEST=job_env"},
+		},
+		Logger: logger,
+	}
+	app.Job = NewJob(app)
+
+	return app, func() {
+		os.RemoveAll(libPath)
+	}
+}
+
+func Test_JobExecuteScript(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	detail := model.NewJobDetail()
+	detail.Code = "job_script"
+	detail.Type = model2.Other
+	detail.Script.SetValid("echo $AGENTE_TEST $AGENTE_JOB_CODE; pwd; echo failed 1>&2; exit 3")
+
+	result := app.Job.Execute(detail)
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	if result.ExitCode != 3 {
+		t.Fatalf("exit code: %d", result.ExitCode)
+	}
+
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	if lines[0] != "job_env job_script" {
+		t.Fatalf("stdout: %s", result.Stdout)
+	}
+
+	dir, _ := filepath.EvalSymlinks(app.Job.WorkDir(detail))
+	if lines[1] != dir {
+		t.Fatalf("working directory: %s", lines[1])
+	}
+
+	if strings.TrimSpace(result.Stderr) != "failed" {
+		t.Fatalf("stderr: %s", result.Stderr)
+	}
+
+	if result.Success() {
+		t.Fatal("job should not be success")
+	}
+}
+
+func Test_JobExecuteScriptFile(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	err := ioutil.WriteFile(filepath.Join(app.Config.LibPath, "script.sh"), []byte("echo script file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detail := model.NewJobDetail()
+	detail.Code = "job_script_file"
+	detail.ScriptFile.SetValid("script.sh")
+
+	result := app.Job.Execute(detail)
+	if !result.Success() {
+		t.Fatal(result.Error, result.Stderr)
+	}
+
+	if strings.TrimSpace(result.Stdout) != "script file" {
+		t.Fatalf("stdout: %s", result.Stdout)
+	}
+}
+
+func Test_JobExecuteTimeout(t *testing.T) {
+	app, clean := newJobTestApp(t, 1)
+	defer clean()
+
+	detail := model.NewJobDetail()
+	detail.Code = "job_timeout"
+	detail.Script.SetValid("exec sleep 5")
+
+	result := app.Job.Execute(detail)
+	if result.Error == nil || result.ExitCode != -1 {
+		t.Fatalf("job should be timed out, exit code: %d", result.ExitCode)
+	}
+}
+
+func Test_JobExecuteTimeoutWithChildren(t *testing.T) {
+	app, clean := newJobTestApp(t, 1)
+	defer clean()
+
+	detail := model.NewJobDetail()
+	detail.Code = "job_timeout_children"
+	detail.Script.SetValid("sleep 5; echo done")
+
+	started := time.Now()
+	result := app.Job.Execute(detail)
+	if result.Error == nil || result.ExitCode != -1 {
+		t.Fatalf("job should be timed out, exit code: %d", result.ExitCode)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Fatalf("children of timed out job should be killed: %s", elapsed)
+	}
+	if strings.Contains(result.Stdout, "done") {
+		t.Fatal("job should not be finished")
+	}
+}
+
+func Test_JobExecuteWithoutScript(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	detail := model.NewJobDetail()
+	detail.Code = "job_empty"
+
+	result := app.Job.Execute(detail)
+	if result.Error == nil {
+		t.Fatal("job without script should be failed")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"bufio"
+	"github.com/streetbyters/agente/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMessageTTL duration received message identifiers are kept. Every
+// message younger than max age is kept, so replayed messages are either
+// expired or seen.
+const DefaultMessageTTL = DefaultMessageMaxAge + model.MessageClockSkew
+
+// MessageCache received message identifiers. It is used to drop messages
+// delivered more than once. Identifiers are written to a journal file if
+// the cache is persisted, so that messages redelivered after a restart are
+// dropped too.
+type MessageCache struct {
+	TTL       time.Duration
+	ids       map[string]time.Time
+	lastPrune time.Time
+	path      string
+	journal   *os.File
+	mutex     sync.Mutex
+}
+
+// NewMessageCache building received message identifier cache
+func NewMessageCache(ttl time.Duration) *MessageCache {
+	return &MessageCache{
+		TTL:       ttl,
+		ids:       make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// MessageCachePath journal file of received message identifiers in lib path
+func MessageCachePath(app *App) string {
+	return filepath.Join(app.Config.LibPath, "messages", app.Config.NodeName)
+}
+
+// Persist load received message identifiers from the journal file and
+// write identifiers to it from now on
+func (c *MessageCache) Persist(path string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 {
+				continue
+			}
+			expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			if expiresAt == 0 {
+				delete(c.ids, fields[0])
+			} else {
+				c.ids[fields[0]] = time.Unix(expiresAt, 0)
+			}
+		}
+		f.Close()
+	}
+
+	c.path = path
+	return c.compact(time.Now())
+}
+
+// Seen record message identifier and report whether it was already seen
+func (c *MessageCache) Seen(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastPrune) > c.TTL || now.Sub(c.lastPrune) > time.Hour {
+		c.compact(now)
+	}
+
+	if expiresAt, ok := c.ids[id]; ok && now.Before(expiresAt) {
+		return true
+	}
+	c.ids[id] = now.Add(c.TTL)
+	c.write(id, c.ids[id].Unix())
+
+	return false
+}
+
+// Forget remove message identifier so that a redelivered message is not
+// dropped
+func (c *MessageCache) Forget(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.ids, id)
+	c.write(id, 0)
+}
+
+// Close journal file of the cache
+func (c *MessageCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.journal == nil {
+		return nil
+	}
+	err := c.journal.Close()
+	c.journal = nil
+
+	return err
+}
+
+// write append identifier with its expire time to the journal file. Zero
+// expire time removes the identifier.
+func (c *MessageCache) write(id string, expiresAt int64) {
+	if c.journal == nil {
+		return
+	}
+
+	c.journal.WriteString(id + " " + strconv.FormatInt(expiresAt, 10) + "\n")
+}
+
+// compact drop expired identifiers and rewrite the journal file with the
+// remaining ones
+func (c *MessageCache) compact(now time.Time) error {
+	for key, expiresAt := range c.ids {
+		if now.After(expiresAt) {
+			delete(c.ids, key)
+		}
+	}
+	c.lastPrune = now
+
+	if c.path == "" {
+		return nil
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, expiresAt := range c.ids {
+		w.WriteString(key + " " + strconv.FormatInt(expiresAt.Unix(), 10) + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	if c.journal != nil {
+		c.journal.Close()
+	}
+	c.journal, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0600)
+
+	return err
+}
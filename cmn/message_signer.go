@@ -0,0 +1,97 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"github.com/streetbyters/agente/model"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMessageMaxAge maximum age of a received message if MESSAGE_MAX_AGE
+// is not set. Durable queues hold messages while a node is down, so it is
+// longer than the queue retention. Replayed messages younger than max age
+// are dropped with the received message identifiers.
+const DefaultMessageMaxAge = 7 * 24 * time.Hour
+
+// MessageSigner signs published queuing messages and verifies received
+// messages with the channel secret. Secret key is used if CHANNEL_SECRET
+// is not set.
+type MessageSigner struct {
+	App      *App
+	Key      []byte
+	MaxAge   time.Duration
+	rejected uint64
+}
+
+// NewMessageSigner building queuing message signer
+func NewMessageSigner(app *App) *MessageSigner {
+	key := app.Config.ChannelSecret
+	if key == "" {
+		key = app.Config.SecretKey
+	}
+
+	return &MessageSigner{App: app, Key: []byte(key), MaxAge: MessageMaxAge(app)}
+}
+
+// MessageMaxAge maximum age of a received message
+func MessageMaxAge(app *App) time.Duration {
+	if app.Config.MessageMaxAge <= 0 {
+		return DefaultMessageMaxAge
+	}
+
+	return time.Duration(app.Config.MessageMaxAge) * time.Second
+}
+
+// Seal signed envelope json of the message
+func (s *MessageSigner) Seal(message *model.ReceivedMessage) string {
+	return model.NewMessageEnvelope(message, s.App.Config.NodeName, s.Key, time.Now()).ToJSON()
+}
+
+// Open verify received envelope json and return its message. Rejected
+// messages are logged and counted.
+func (s *MessageSigner) Open(str string) *model.ReceivedMessage {
+	envelope, err := model.ParseMessageEnvelope(str)
+	if err == nil {
+		var message *model.ReceivedMessage
+		if message, err = envelope.Open(s.Key, s.MaxAge, time.Now()); err == nil {
+			return message
+		}
+		err = &MessageError{ID: envelope.ID, Origin: envelope.Origin, Err: err}
+	}
+
+	atomic.AddUint64(&s.rejected, 1)
+	s.App.Logger.LogError(err, "Rejected message")
+
+	return nil
+}
+
+// Rejected number of rejected messages
+func (s *MessageSigner) Rejected() uint64 {
+	return atomic.LoadUint64(&s.rejected)
+}
+
+// MessageError rejected message error with envelope identifier and origin
+type MessageError struct {
+	ID     string
+	Origin string
+	Err    error
+}
+
+func (e *MessageError) Error() string {
+	return e.Err.Error() + ": " + e.ID + " from " + e.Origin
+}
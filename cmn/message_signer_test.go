@@ -0,0 +1,43 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/model"
+	"testing"
+	"time"
+)
+
+func Test_MessageSigner(t *testing.T) {
+	master := NewMessageSigner(&App{Config: &model.Config{NodeName: "node_master@host", SecretKey: "secret"}, Logger: logger})
+	worker := NewMessageSigner(&App{Config: &model.Config{NodeName: "node_worker@host", SecretKey: "secret"}, Logger: logger})
+	other := NewMessageSigner(&App{Config: &model.Config{SecretKey: "secret", ChannelSecret: "channel"}, Logger: logger})
+
+	message := model.NewJobMessage("deploy", model.NewRelease)
+	sealed := master.Seal(message)
+
+	if received := worker.Open(sealed); received == nil || received.ID != message.ID {
+		t.Fatalf("unexpected message: %v", received)
+	}
+	if worker.Rejected() != 0 {
+		t.Fatal("valid message should not be rejected")
+	}
+
+	if other.Open(sealed) != nil {
+		t.Fatal("message signed with another key should be rejected")
+	}
+	if worker.Open(message.ToJSON()) != nil || worker.Open("{") != nil {
+		t.Fatal("unsigned message should be rejected")
+	}
+	if other.Rejected() != 1 || worker.Rejected() != 2 {
+		t.Fatalf("unexpected rejected count: %d %d", other.Rejected(), worker.Rejected())
+	}
+
+	queued := model.NewMessageEnvelope(message, "node_master@host", master.Key, time.Now().Add(-24*time.Hour)).ToJSON()
+	if worker.Open(queued) == nil {
+		t.Fatal("message queued during an outage should be opened")
+	}
+
+	limited := NewMessageSigner(&App{Config: &model.Config{SecretKey: "secret", MessageMaxAge: 60}, Logger: logger})
+	if limited.MaxAge != time.Minute || limited.Open(queued) != nil {
+		t.Fatal("message older than configured max age should be rejected")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"github.com/streetbyters/agente/utils"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version agente version reported by nodes
+const Version = "0.1.0"
+
+// DefaultHeartbeatInterval seconds between node heartbeats if
+// HEARTBEAT_INTERVAL is not set
+const DefaultHeartbeatInterval = 30
+
+// NodeMonitor sends heartbeats of this node. Master nodes also mark nodes
+// offline if they miss heartbeats longer than the timeout.
+type NodeMonitor struct {
+	App      *App
+	Interval time.Duration
+	Timeout  time.Duration
+	stop     chan bool
+}
+
+// NewNodeMonitor building node monitor and start sending heartbeats
+func NewNodeMonitor(app *App) *NodeMonitor {
+	interval := app.Config.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+
+	timeout := app.Config.HeartbeatTimeout
+	if timeout <= interval {
+		timeout = interval * 3
+	}
+
+	m := &NodeMonitor{
+		App:      app,
+		Interval: time.Duration(interval) * time.Second,
+		Timeout:  time.Duration(timeout) * time.Second,
+		stop:     make(chan bool),
+	}
+	go m.Run()
+
+	return m
+}
+
+// Run send heartbeats until the monitor is stopped
+func (m *NodeMonitor) Run() {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.Beat()
+		}
+	}
+}
+
+// Beat publish heartbeat of this node and mark nodes missed heartbeats
+// offline on master nodes
+func (m *NodeMonitor) Beat() {
+	message := model.NewHeartbeatMessage(NewNodeHeartbeat(m.App))
+	if err := m.App.Queue.Publish(message); err != nil {
+		m.App.Logger.LogError(err, "node heartbeat could not be published")
+	}
+	m.syncTags()
+
+	if m.App.Config.NodeType != model.Master {
+		return
+	}
+
+	codes, err := MarkOfflineNodes(m.App, time.Now().UTC().Add(-m.Timeout))
+	if err != nil {
+		m.App.Logger.LogError(err, "offline nodes could not be marked")
+	}
+	for _, code := range codes {
+		m.App.Logger.LogInfo("Node is offline: " + code)
+	}
+}
+
+// syncTags take over tags of this node changed over the api
+func (m *NodeMonitor) syncTags() {
+	if m.App.Database == nil {
+		return
+	}
+
+	node := new(model2.Node)
+	var tags model2.Strings
+	err := m.App.Database.DB.Get(&tags, fmt.Sprintf("SELECT tags FROM %s WHERE code = $1",
+		node.TableName()), m.App.Config.NodeName)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			m.App.Logger.LogError(err, "node tags could not be read")
+		}
+		return
+	}
+
+	SyncNodeTags(m.App, tags)
+}
+
+// Stop heartbeats and mark this node offline
+func (m *NodeMonitor) Stop() {
+	close(m.stop)
+
+	if m.App.Database == nil || m.App.Node == nil {
+		return
+	}
+
+	node := new(model2.Node)
+	if _, err := m.App.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET state = $1 WHERE id = $2",
+		node.TableName()), model.NodeOffline, m.App.Node.ID); err != nil {
+		m.App.Logger.LogError(err, "node could not be marked offline")
+	}
+}
+
+// NodeAddress api address of this node
+func NodeAddress(app *App) string {
+	if app.Config.Address != "" {
+		return app.Config.Address
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return hostname + ":" + strconv.Itoa(app.Config.Port)
+}
+
+// NodeURL api base url of this node. Scheme of the address is kept, http
+// is used for addresses without a scheme.
+func NodeURL(app *App) string {
+	address := strings.TrimRight(NodeAddress(app), "/")
+	if strings.Contains(address, "://") {
+		return address
+	}
+
+	return "http://" + address
+}
+
+// NodeCapabilities job types this node can handle
+func NodeCapabilities(app *App) []string {
+	var capabilities []string
+	for typ := range NewJob(app).Handlers() {
+		capabilities = append(capabilities, string(typ))
+	}
+	sort.Strings(capabilities)
+
+	return capabilities
+}
+
+// NewNodeHeartbeat building heartbeat of this node
+func NewNodeHeartbeat(app *App) *model.NodeHeartbeat {
+	typ := app.Config.NodeType
+	if typ == "" {
+		typ = model.Worker
+	}
+
+	return &model.NodeHeartbeat{
+		Node:         app.Config.NodeName,
+		Type:         typ,
+		Version:      Version,
+		Address:      NodeAddress(app),
+		Capabilities: NodeCapabilities(app),
+		Tags:         app.Tags(),
+	}
+}
+
+// RegisterNode create or update node information of this node
+func RegisterNode(app *App) (*model2.Node, error) {
+	node, err := TouchNode(app, NewNodeHeartbeat(app))
+	if err != nil {
+		return nil, err
+	}
+	app.Node = node
+	SyncNodeTags(app, node.Tags)
+
+	return node, nil
+}
+
+// SyncNodeTags route messages of given tags to this node and rebind the
+// channel if tags are changed. Tags not set yet are left as they are.
+func SyncNodeTags(app *App, tags []string) {
+	if tags == nil {
+		return
+	}
+
+	removed, added := diffTags(app.Tags(), tags)
+	if len(removed) == 0 && len(added) == 0 {
+		return
+	}
+
+	old := app.SetTags(tags)
+	app.Logger.LogInfo("Node tags changed: " + strings.Join(tags, ","))
+
+	if rebinder, ok := app.Queue.(ChannelRebinder); ok {
+		if err := rebinder.Rebind(old, tags); err != nil {
+			app.Logger.LogError(err, "node tags could not be bound")
+		}
+	}
+}
+
+// diffTags tags removed from and added to old tags
+func diffTags(old []string, tags []string) ([]string, []string) {
+	var removed, added []string
+	for _, tag := range old {
+		if ok, _ := utils.InArray(tag, tags); !ok {
+			removed = append(removed, tag)
+		}
+	}
+	for _, tag := range tags {
+		if ok, _ := utils.InArray(tag, old); !ok {
+			added = append(added, tag)
+		}
+	}
+
+	return removed, added
+}
+
+// TouchNode create or update node of the heartbeat and mark it online. Node
+// tags are only taken from the heartbeat if the node has none, afterwards
+// they are managed by the api and taken over by the node with SyncNodeTags.
+func TouchNode(app *App, heartbeat *model.NodeHeartbeat) (*model2.Node, error) {
+	if app.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	node := model2.NewNode()
+	var state model.NodeState
+	app.Database.DB.Get(&state, fmt.Sprintf("SELECT state FROM %s WHERE code = $1",
+		node.TableName()), heartbeat.Node)
+
+	res := app.Database.QueryRowWithModel(fmt.Sprintf("INSERT INTO %s "+
+		"(name, code, type, version, address, capabilities, tags, state, last_seen_at) "+
+		"VALUES ($1, $1, $2, $3, $4, $5, $6, $7, (CURRENT_TIMESTAMP at time zone 'utc')) "+
+		"ON CONFLICT (code) DO UPDATE SET type = EXCLUDED.type, version = EXCLUDED.version, "+
+		"address = EXCLUDED.address, capabilities = EXCLUDED.capabilities, "+
+		"tags = COALESCE(%s.tags, EXCLUDED.tags), state = EXCLUDED.state, "+
+		"last_seen_at = EXCLUDED.last_seen_at, "+
+		"updated_at = (CURRENT_TIMESTAMP at time zone 'utc') RETURNING *", node.TableName(), node.TableName()),
+		node,
+		heartbeat.Node,
+		heartbeat.Type,
+		heartbeat.Version,
+		heartbeat.Address,
+		model2.Strings(heartbeat.Capabilities),
+		model2.Strings(heartbeat.Tags),
+		model.NodeOnline)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if state != model.NodeOnline {
+		app.Logger.LogInfo("Node is online: " + node.Code)
+	}
+
+	return node, nil
+}
+
+// MarkOfflineNodes mark online nodes last seen before given time offline
+// and return their codes
+func MarkOfflineNodes(app *App, before time.Time) ([]string, error) {
+	if app.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	node := new(model2.Node)
+	var codes []string
+	err := app.Database.DB.Select(&codes, fmt.Sprintf("UPDATE %s SET state = $1 "+
+		"WHERE state = $2 AND (last_seen_at IS NULL OR last_seen_at < $3) RETURNING code",
+		node.TableName()), model.NodeOffline, model.NodeOnline, before)
+
+	return codes, err
+}
+
+// heartbeat update node of the heartbeat received from the channel
+func heartbeat(app *App, message *model.ReceivedMessage) {
+	if _, err := TouchNode(app, message.Heartbeat); err != nil {
+		app.Logger.LogError(err, "node heartbeat could not be saved: "+message.Heartbeat.Node)
+	}
+}
@@ -0,0 +1,89 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/model"
+	"reflect"
+	"testing"
+)
+
+func Test_NewNodeHeartbeat(t *testing.T) {
+	app := &App{Config: &model.Config{NodeName: "node_worker@host", Port: 3002}, Logger: logger}
+
+	heartbeat := NewNodeHeartbeat(app)
+	if heartbeat.Node != "node_worker@host" || heartbeat.Type != model.Worker || heartbeat.Version != Version {
+		t.Fatalf("unexpected heartbeat: %+v", heartbeat)
+	}
+
+	capabilities := []string{"new_release", "other", "restart", "shutdown", "start"}
+	if !reflect.DeepEqual(heartbeat.Capabilities, capabilities) {
+		t.Fatalf("unexpected capabilities: %v", heartbeat.Capabilities)
+	}
+
+	app.Config.Address = "10.0.0.2:3002"
+	app.Config.NodeType = model.Master
+	heartbeat = NewNodeHeartbeat(app)
+	if heartbeat.Address != "10.0.0.2:3002" || heartbeat.Type != model.Master {
+		t.Fatalf("unexpected heartbeat: %+v", heartbeat)
+	}
+
+	message := model.NewHeartbeatMessage(heartbeat)
+	if !message.Targets("node_master@host", model.Master, nil) || message.Targets("node_worker@host", model.Worker, nil) {
+		t.Fatal("heartbeat should only target master nodes")
+	}
+
+	if result := receive(&App{Config: &model.Config{NodeType: model.Master}, Logger: logger}, message); result != nil {
+		t.Fatal("heartbeat should not run a job")
+	}
+}
+
+func Test_NodeURL(t *testing.T) {
+	app := &App{Config: &model.Config{Address: "10.0.0.2:3002"}, Logger: logger}
+	if url := NodeURL(app); url != "http://10.0.0.2:3002" {
+		t.Fatalf("unexpected url: %s", url)
+	}
+
+	app.Config.Address = "https://agente.example.com/"
+	if url := NodeURL(app); url != "https://agente.example.com" {
+		t.Fatalf("unexpected url: %s", url)
+	}
+}
+
+type testRebinder struct {
+	ChannelInterface
+	old  []string
+	tags []string
+}
+
+func (r *testRebinder) Rebind(old []string, tags []string) error {
+	r.old, r.tags = old, tags
+	return nil
+}
+
+func Test_SyncNodeTags(t *testing.T) {
+	rebinder := &testRebinder{}
+	app := &App{Config: &model.Config{Tags: []string{"web"}}, Logger: logger, Queue: rebinder}
+
+	SyncNodeTags(app, nil)
+	if !reflect.DeepEqual(app.Tags(), []string{"web"}) || rebinder.tags != nil {
+		t.Fatalf("unset tags should be left as they are: %v", app.Tags())
+	}
+
+	SyncNodeTags(app, []string{"web", "eu"})
+	if !reflect.DeepEqual(app.Tags(), []string{"web", "eu"}) {
+		t.Fatalf("tags should be taken over: %v", app.Tags())
+	}
+	if !reflect.DeepEqual(rebinder.old, []string{"web"}) || !reflect.DeepEqual(rebinder.tags, []string{"web", "eu"}) {
+		t.Fatalf("channel should be rebound: %v %v", rebinder.old, rebinder.tags)
+	}
+
+	rebinder.tags = nil
+	SyncNodeTags(app, []string{"eu", "web"})
+	if rebinder.tags != nil {
+		t.Fatal("channel should not be rebound if tags are not changed")
+	}
+
+	removed, added := diffTags([]string{"web", "eu"}, []string{})
+	if !reflect.DeepEqual(removed, []string{"web", "eu"}) || added != nil {
+		t.Fatalf("unexpected tag diff: %v %v", removed, added)
+	}
+}
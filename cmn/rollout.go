@@ -0,0 +1,177 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"time"
+)
+
+// DefaultRolloutTimeout duration nodes have to reply the job of a rollout.
+// It is extended to the job timeout if the job timeout is longer.
+const DefaultRolloutTimeout = time.Hour
+
+// RolloutTimeout duration nodes have to reply the job of a rollout
+func RolloutTimeout(app *App) time.Duration {
+	timeout := time.Duration(app.Config.JobTimeout) * time.Second
+	if timeout < DefaultRolloutTimeout {
+		return DefaultRolloutTimeout
+	}
+
+	return timeout
+}
+
+// ExpectedNodes codes of the nodes expected to reply a job message with the
+// given targets. Nodes given by code are always expected, online nodes of
+// the registry are expected if the targets match their type or tags.
+func ExpectedNodes(app *App, targets model.MessageTargets) ([]string, error) {
+	expected := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, node := range targets.Nodes {
+		if !seen[node] {
+			seen[node] = true
+			expected = append(expected, node)
+		}
+	}
+
+	var nodes []model2.Node
+	err := app.Database.DB.Select(&nodes, fmt.Sprintf("SELECT * FROM %s WHERE state = $1 ORDER BY code ASC",
+		new(model2.Node).TableName()),
+		model.NodeOnline)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if !seen[node.Code] && targets.Targets(node.Code, node.Type, node.Tags) {
+			seen[node.Code] = true
+			expected = append(expected, node.Code)
+		}
+	}
+
+	return expected, nil
+}
+
+// NewJobReply building job reply of this node with the job result
+func NewJobReply(app *App, result *JobResult) *model.JobReply {
+	reply := &model.JobReply{
+		Node:     app.Config.NodeName,
+		RunID:    result.LogID,
+		Status:   model.RolloutSucceeded,
+		ExitCode: result.ExitCode,
+		Digest:   OutputDigest(result),
+	}
+
+	if !result.FinishedAt.IsZero() {
+		reply.Duration = int64(result.FinishedAt.Sub(result.StartedAt) / time.Millisecond)
+	}
+
+	if !result.Success() {
+		reply.Status = model.RolloutFailed
+	}
+	if result.Error != nil {
+		reply.Error = result.Error.Error()
+	}
+
+	return reply
+}
+
+// OutputDigest sha256 digest of job result stdout and stderr
+func OutputDigest(result *JobResult) string {
+	h := sha256.New()
+	h.Write([]byte(result.Stdout))
+	h.Write([]byte{0})
+	h.Write([]byte(result.Stderr))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reply publish job result to the node which published the job message
+func reply(app *App, message *model.ReceivedMessage, result *JobResult) {
+	if message.ReplyTo == "" || result == nil || app.Queue == nil {
+		return
+	}
+
+	replyMessage := model.NewReplyMessage(message, NewJobReply(app, result))
+	if err := app.Queue.Publish(replyMessage); err != nil {
+		app.Logger.LogError(err, "job reply could not be published: "+message.ID)
+	}
+}
+
+// Collect write job reply to the results of its rollout. Latest reply of a
+// node replaces the former one so that redelivered jobs update the result.
+func Collect(app *App, reply *model.JobReply) (*model2.RolloutResult, error) {
+	if app.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	rollout := new(model2.Rollout)
+	res := app.Database.QueryRowWithModel(fmt.Sprintf("SELECT * FROM %s WHERE message_id = $1",
+		rollout.TableName()),
+		rollout,
+		reply.MessageID)
+	if res.Error != nil {
+		return nil, errors.New("rollout not found for message: " + reply.MessageID)
+	}
+
+	result := model2.NewRolloutResult(rollout.ID)
+	result.Node = reply.Node
+	result.Status = reply.Status
+	result.ExitCode = reply.ExitCode
+	result.Duration = reply.Duration
+	result.Digest.SetValid(reply.Digest)
+	if reply.RunID > 0 {
+		result.RunID.SetValid(reply.RunID)
+	}
+	if reply.Error != "" {
+		result.Error.SetValid(reply.Error)
+	}
+
+	res = app.Database.QueryRowWithModel(fmt.Sprintf("INSERT INTO %s "+
+		"(rollout_id, node, run_id, status, exit_code, duration, digest, error) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) "+
+		"ON CONFLICT (rollout_id, node) DO UPDATE SET run_id = EXCLUDED.run_id, "+
+		"status = EXCLUDED.status, exit_code = EXCLUDED.exit_code, duration = EXCLUDED.duration, "+
+		"digest = EXCLUDED.digest, error = EXCLUDED.error, "+
+		"updated_at = (CURRENT_TIMESTAMP at time zone 'utc') RETURNING *", result.TableName()),
+		result,
+		result.RolloutID,
+		result.Node,
+		result.RunID,
+		result.Status,
+		result.ExitCode,
+		result.Duration,
+		result.Digest,
+		result.Error)
+
+	return result, res.Error
+}
+
+// collect job reply received from the channel
+func collect(app *App, message *model.ReceivedMessage) {
+	app.Logger.LogInfo(fmt.Sprintf("Receive job reply: %s %s %s",
+		message.Reply.MessageID, message.Reply.Node, message.Reply.Status))
+
+	if _, err := Collect(app, message.Reply); err != nil {
+		app.Logger.LogError(err, "job reply could not be collected: "+message.Reply.MessageID)
+	}
+}
@@ -0,0 +1,32 @@
+package cmn
+
+import (
+	"errors"
+	"github.com/streetbyters/agente/model"
+	"testing"
+	"time"
+)
+
+func Test_NewJobReply(t *testing.T) {
+	app := &App{Config: &model.Config{NodeName: "node_worker@host"}, Logger: logger}
+	startedAt := time.Now()
+
+	reply := NewJobReply(app, &JobResult{
+		LogID:      7,
+		Stdout:     "deployed",
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+	})
+	if reply.Node != "node_worker@host" || reply.RunID != 7 || reply.Status != model.RolloutSucceeded ||
+		reply.Duration != 1500 || len(reply.Digest) != 64 {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+
+	failed := NewJobReply(app, &JobResult{ExitCode: -1, Error: errors.New("timeout"), Stdout: "deployed"})
+	if failed.Status != model.RolloutFailed || failed.Error != "timeout" || failed.Duration != 0 {
+		t.Fatalf("unexpected reply: %+v", failed)
+	}
+	if failed.Digest != reply.Digest {
+		t.Fatal("same output should have the same digest")
+	}
+}
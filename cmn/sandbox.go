@@ -0,0 +1,164 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathNotAllowed path is outside of lib path and allowed roots
+var ErrPathNotAllowed = errors.New("path is not allowed")
+
+// Roots lib path and allowed roots which files can be read and written in
+func Roots(app *App) []string {
+	roots := []string{filepath.Clean(app.Config.LibPath)}
+	for _, root := range app.Config.AllowedRoots {
+		if filepath.IsAbs(root) {
+			roots = append(roots, filepath.Clean(root))
+		}
+	}
+
+	return roots
+}
+
+// ReservedDirs directories of agente state in lib path. Blobs, upload
+// parts, pid files, received messages and releases can not be read or
+// written as job files.
+func ReservedDirs(app *App) []string {
+	return []string{
+		filepath.Join(app.Config.LibPath, "blobs"),
+		filepath.Join(app.Config.LibPath, "run"),
+		filepath.Join(app.Config.LibPath, "messages"),
+		filepath.Join(app.Config.LibPath, "releases"),
+	}
+}
+
+// ResolvePath resolve file name in dir confined to lib path and allowed
+// roots. Relative dirs are resolved in lib path. Paths with parent
+// references, names with separators, paths in reserved dirs and paths
+// escaping the roots through symlinks are not allowed.
+func ResolvePath(app *App, dir string, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", ErrPathNotAllowed
+	}
+
+	dir, err := ResolveDir(app, dir)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	if !confined(app, path) || reserved(app, path) {
+		return "", ErrPathNotAllowed
+	}
+
+	return path, nil
+}
+
+// ResolveDir resolve dir confined to lib path and allowed roots outside of
+// the reserved dirs
+func ResolveDir(app *App, dir string) (string, error) {
+	if dir == "" {
+		return "", ErrPathNotAllowed
+	}
+
+	for _, part := range strings.FieldsFunc(dir, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return "", ErrPathNotAllowed
+		}
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(app.Config.LibPath, dir)
+	}
+	dir = filepath.Clean(dir)
+
+	if !confined(app, dir) || reserved(app, dir) {
+		return "", ErrPathNotAllowed
+	}
+
+	return dir, nil
+}
+
+// confined path and the path its symlinks point to are in one of the roots
+func confined(app *App, path string) bool {
+	real, err := realPath(path)
+	if err != nil {
+		return false
+	}
+
+	for _, root := range Roots(app) {
+		realRoot, err := realPath(root)
+		if err != nil {
+			continue
+		}
+		if within(root, path) && within(realRoot, real) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reserved path or the path its symlinks point to is in a reserved dir
+func reserved(app *App, path string) bool {
+	real, err := realPath(path)
+	if err != nil {
+		return true
+	}
+
+	for _, dir := range ReservedDirs(app) {
+		if within(dir, path) || within(dir, real) {
+			return true
+		}
+		if realDir, err := realPath(dir); err == nil && within(realDir, real) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// realPath path with symlinks of its existing part evaluated
+func realPath(path string) (string, error) {
+	var rest []string
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...), nil
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// within path is the root or in the root
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
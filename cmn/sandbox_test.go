@@ -0,0 +1,145 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newSandboxTestApp(t *testing.T) (*App, string, func()) {
+	libPath, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{Config: &model.Config{LibPath: libPath, AllowedRoots: []string{root, "relative"}}, Logger: logger}
+	return app, outside, func() {
+		os.RemoveAll(libPath)
+		os.RemoveAll(root)
+		os.RemoveAll(outside)
+	}
+}
+
+func Test_ResolvePath(t *testing.T) {
+	app, _, clean := newSandboxTestApp(t)
+	defer clean()
+
+	libPath := app.Config.LibPath
+	root := app.Config.AllowedRoots[0]
+
+	if roots := Roots(app); len(roots) != 2 || roots[0] != libPath || roots[1] != root {
+		t.Fatalf("relative allowed roots should be ignored: %v", roots)
+	}
+
+	paths := map[[2]string]string{
+		{"packages", "app.tar.gz"}:                         filepath.Join(libPath, "packages", "app.tar.gz"),
+		{"./packages/", "app.tar.gz"}:                      filepath.Join(libPath, "packages", "app.tar.gz"),
+		{filepath.Join(libPath, "scripts"), "deploy.sh"}:   filepath.Join(libPath, "scripts", "deploy.sh"),
+		{root, "app.tar.gz"}:                               filepath.Join(root, "app.tar.gz"),
+		{filepath.Join(root, "a", "b"), "app.tar.gz"}:      filepath.Join(root, "a", "b", "app.tar.gz"),
+		{filepath.Join(root, "a", ".", "b"), "app.tar.gz"}: filepath.Join(root, "a", "b", "app.tar.gz"),
+	}
+	for args, expected := range paths {
+		path, err := ResolvePath(app, args[0], args[1])
+		if err != nil || path != expected {
+			t.Fatalf("unexpected path of %v: %s %v", args, path, err)
+		}
+	}
+
+	for _, args := range [][2]string{
+		{"", "app.tar.gz"},
+		{"packages", ""},
+		{"packages", ".."},
+		{"packages", "../app.tar.gz"},
+		{"packages", "a/app.tar.gz"},
+		{"..", "app.tar.gz"},
+		{"../etc", "passwd"},
+		{"packages/../../etc", "passwd"},
+		{libPath + "/../" + filepath.Base(libPath), "app.tar.gz"},
+		{"/etc", "passwd"},
+		{"/", "app.tar.gz"},
+		{filepath.Dir(libPath), "app.tar.gz"},
+		{libPath + "2", "app.tar.gz"},
+	} {
+		if path, err := ResolvePath(app, args[0], args[1]); err != ErrPathNotAllowed {
+			t.Fatalf("path should not be allowed %v: %s", args, path)
+		}
+	}
+}
+
+func Test_ResolvePathWithSymlinks(t *testing.T) {
+	app, outside, clean := newSandboxTestApp(t)
+	defer clean()
+
+	libPath := app.Config.LibPath
+	os.MkdirAll(filepath.Join(libPath, "packages"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644)
+
+	if err := os.Symlink(outside, filepath.Join(libPath, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(libPath, "secret"))
+	os.Symlink(filepath.Join(outside, "missing"), filepath.Join(libPath, "dangling"))
+	os.Symlink(filepath.Join(libPath, "packages"), filepath.Join(libPath, "current"))
+
+	for _, args := range [][2]string{
+		{"escape", "secret"},
+		{"escape/new", "app.tar.gz"},
+		{libPath, "secret"},
+		{libPath, "dangling"},
+	} {
+		if path, err := ResolvePath(app, args[0], args[1]); err != ErrPathNotAllowed {
+			t.Fatalf("path escaping lib path should not be allowed %v: %s", args, path)
+		}
+	}
+
+	path, err := ResolvePath(app, "current", "app.tar.gz")
+	if err != nil || path != filepath.Join(libPath, "current", "app.tar.gz") {
+		t.Fatalf("symlink in lib path should be allowed: %s %v", path, err)
+	}
+}
+
+func Test_ResolvePathInReservedDirs(t *testing.T) {
+	app, _, clean := newSandboxTestApp(t)
+	defer clean()
+
+	libPath := app.Config.LibPath
+	for _, dir := range ReservedDirs(app) {
+		os.MkdirAll(dir, os.ModePerm)
+	}
+	os.Symlink(filepath.Join(libPath, "run"), filepath.Join(libPath, "pids"))
+
+	for _, args := range [][2]string{
+		{"blobs/sha256/ab", "ab12"},
+		{filepath.Join(libPath, "blobs", "sha256", "ab"), "ab12"},
+		{"blobs/parts", "1"},
+		{"run", "app.pid"},
+		{"./run/", "app.pid"},
+		{"messages", "node_worker@host"},
+		{"releases/app", "app.jar"},
+		{"packages/../releases", "app.tar.gz"},
+		{libPath, "blobs"},
+		{libPath, "run"},
+		{"pids", "app.pid"},
+	} {
+		if path, err := ResolvePath(app, args[0], args[1]); err != ErrPathNotAllowed {
+			t.Fatalf("path in reserved dir should not be allowed %v: %s", args, path)
+		}
+	}
+
+	for _, dir := range []string{"blobs", "run/", "messages", "releases/app", "pids"} {
+		if path, err := ResolveDir(app, dir); err != ErrPathNotAllowed {
+			t.Fatalf("reserved dir should not be allowed %s: %s", dir, path)
+		}
+	}
+}
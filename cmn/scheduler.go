@@ -18,7 +18,13 @@ package cmn
 
 import (
 	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
 	"github.com/streetbyters/agente/utils"
+	"strings"
+	"time"
 )
 
 // Scheduler application job scheduler
@@ -29,7 +35,20 @@ type Scheduler struct {
 
 // SchedulerJob General scheduler job struct
 type SchedulerJob struct {
-	Data interface{} `json:"data"`
+	JobID    int64       `json:"job_id"`
+	Code     string      `json:"code"`
+	Schedule string      `json:"schedule"`
+	NextRun  time.Time   `json:"next_run"`
+	Data     interface{} `json:"data"`
+}
+
+// Schedule parsed job schedule expression
+type Schedule struct {
+	cron.Schedule
+	Spec    string
+	Every   time.Duration
+	Weekday *time.Weekday
+	At      string
 }
 
 // Packages All defined scheduler packages
@@ -37,8 +56,9 @@ func (s *Scheduler) Packages() ([]string, map[string]SchedulerInterface) {
 	packages := make(map[string]SchedulerInterface)
 
 	packages["GoCron"] = &SchedulerGoCron{Scheduler: s}
+	packages["JobRunner"] = &SchedulerJobRunner{Scheduler: s}
 
-	return []string{"GoCron"}, packages
+	return []string{"GoCron", "JobRunner"}, packages
 }
 
 // SchedulerInterface application job scheduler interface
@@ -46,11 +66,12 @@ type SchedulerInterface interface {
 	Up()
 	Down()
 	Start()
-	List()
-	Add(args ...interface{})
-	Update(args ...interface{})
-	Delete(args ...interface{})
-	Run()
+	List() []*SchedulerJob
+	Add(detail *model2.JobDetail) error
+	Update(detail *model2.JobDetail) error
+	Delete(jobID int64)
+	Run(jobID int64) error
+	Every(name string, interval time.Duration, task func()) error
 	Stop()
 }
 
@@ -66,5 +87,73 @@ func NewScheduler(app *App) *Scheduler {
 
 	s.Package = packages[app.Config.Scheduler]
 	s.Package.Up()
+	s.Package.Start()
 	return s
 }
+
+// errTaskInterval system task interval is shorter than the scheduler resolution
+var errTaskInterval = errors.New("task interval should be at least a second")
+
+// ParseSchedule parse job schedule expression. Standard 5 field cron,
+// 6 field cron with seconds and descriptors (@daily, @every 10m) are
+// accepted. Interval hints are set for descriptors so that packages can
+// schedule them natively at the same time as the cron schedule.
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	parsed, err := utils.ParseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &Schedule{Schedule: parsed, Spec: spec}
+
+	switch spec {
+	case "@daily", "@midnight":
+		schedule.Every = 24 * time.Hour
+		schedule.At = "00:00"
+	case "@weekly":
+		sunday := time.Sunday
+		schedule.Every = 7 * 24 * time.Hour
+		schedule.Weekday = &sunday
+		schedule.At = "00:00"
+	default:
+		if every, ok := parsed.(cron.ConstantDelaySchedule); ok {
+			schedule.Every = every.Delay
+		}
+	}
+
+	return schedule, nil
+}
+
+// Details latest details of scheduled jobs
+func (s *Scheduler) Details() ([]*model2.JobDetail, error) {
+	if s.App.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	detail := model2.NewJobDetail()
+	var details []model2.JobDetail
+	res := s.App.Database.QueryWithModel(fmt.Sprintf("SELECT d.* FROM %s AS d"+
+		" LEFT OUTER JOIN %s AS d2 ON d.job_id = d2.job_id AND d.id < d2.id"+
+		" WHERE d2.id IS NULL AND d.schedule IS NOT NULL AND d.schedule != ''"+
+		" ORDER BY d.id ASC", detail.TableName(), detail.TableName()),
+		&details)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	var rDetails []*model2.JobDetail
+	for i := range details {
+		rDetails = append(rDetails, &details[i])
+	}
+
+	return rDetails, nil
+}
+
+// Trigger run scheduled job detail with the job executor used for channel
+// messages
+func (s *Scheduler) Trigger(detail *model2.JobDetail) *JobResult {
+	s.App.Logger.LogInfo("Triggered scheduled job: " + detail.Code)
+
+	return s.App.Job.Run(&model.ReceivedMessage{JobName: detail.Code, Type: detail.Type})
+}
@@ -17,95 +17,251 @@
 package cmn
 
 import (
-	"fmt"
+	"errors"
 	"github.com/jasonlvhit/gocron"
-	"github.com/jmoiron/sqlx"
 	model2 "github.com/streetbyters/agente/database/model"
+	"sort"
+	"sync"
+	"time"
 )
 
 // SchedulerGoCron gocron package adapter
 type SchedulerGoCron struct {
 	SchedulerInterface `json:"-"`
 	*Scheduler
-	GoCron *gocron.Scheduler
-	Jobs   []Job
+	GoCron   *gocron.Scheduler
+	Jobs     map[int64]*gocron.Job
+	Details  map[int64]*model2.JobDetail
+	Tasks    map[string]*gocron.Job
+	mutex    sync.Mutex
+	stopped  chan bool
+	nextRuns map[int64]time.Time
 }
 
-// Up gocron scheduler
+// Up gocron scheduler and register scheduled jobs
 func (s *SchedulerGoCron) Up() {
+	s.mutex.Lock()
 	s.GoCron = gocron.NewScheduler()
-	jobDetail := model2.NewJobDetail()
-	job := model2.NewJob()
-	var jobs []model2.Job
-	res := s.Scheduler.App.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s"+
-		" AS j", job.TableName()),
-		&jobs)
-	var jobIDs []int64
-	for _, j := range jobs {
-		jobIDs = append(jobIDs, j.ID)
-	}
+	s.Jobs = make(map[int64]*gocron.Job)
+	s.Details = make(map[int64]*model2.JobDetail)
+	s.Tasks = make(map[string]*gocron.Job)
+	s.nextRuns = make(map[int64]time.Time)
+	s.mutex.Unlock()
 
-	var rJobs []model2.Job
-	jobDetails := make([]model2.JobDetail, 0)
-	details := make(map[int64]model2.JobDetail)
-	if res.Error == nil {
-		query, args, _ := sqlx.In(fmt.Sprintf("SELECT d.* FROM %s AS d"+
-			" LEFT OUTER JOIN %s AS d2 ON d.job_id = d2.job_id AND d.id < d2.id"+
-			" WHERE d2.id IS NULL AND d.job_id IN (?)", jobDetail.TableName(), jobDetail.TableName()),
-			jobIDs)
-		query = s.Scheduler.App.Database.DB.Rebind(query)
-		s.Scheduler.App.Database.QueryWithModel(query, &jobDetails, args...)
-
-		for _, d := range jobDetails {
-			details[d.JobID] = d
-		}
+	details, err := s.Scheduler.Details()
+	if err != nil {
+		s.Scheduler.App.Logger.LogError(err, "scheduled jobs could not be loaded")
+		return
+	}
 
-		for _, j := range jobs {
-			if val, ok := details[j.ID]; ok {
-				j.Detail = &val
-			}
-			rJobs = append(rJobs, j)
+	for _, d := range details {
+		if err := s.Add(d); err != nil {
+			s.Scheduler.App.Logger.LogError(err, "job could not be scheduled: "+d.Code)
 		}
 	}
 }
 
-// Start gocron
+// Start gocron ticker
 func (s *SchedulerGoCron) Start() {
-	s.GoCron.Start()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped != nil {
+		return
+	}
+
+	stopped := make(chan bool, 1)
+	s.stopped = stopped
+	ticker := time.NewTicker(time.Second)
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.mutex.Lock()
+				s.GoCron.RunPending()
+				s.mutex.Unlock()
+			case <-stopped:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
 }
 
-// List gcron jobs
-func (s *SchedulerGoCron) List() {
+// List gocron jobs
+func (s *SchedulerGoCron) List() []*SchedulerJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
+	var jobs []*SchedulerJob
+	for jobID, job := range s.Jobs {
+		detail := s.Details[jobID]
+		next, ok := s.nextRuns[jobID]
+		if !ok {
+			next = job.NextScheduledTime()
+		}
+		jobs = append(jobs, &SchedulerJob{
+			JobID:    jobID,
+			Code:     detail.Code,
+			Schedule: detail.Schedule.String,
+			NextRun:  next,
+			Data:     detail,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].JobID < jobs[j].JobID
+	})
+
+	return jobs
 }
 
-// Add gcron job
-func (s *SchedulerGoCron) Add(args ...interface{}) {
+// Add gocron job. Already scheduled job is replaced.
+func (s *SchedulerGoCron) Add(detail *model2.JobDetail) error {
+	schedule, err := ParseSchedule(detail.Schedule.String)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.remove(detail.JobID)
+
+	jobID := detail.JobID
+	run := func() {
+		go s.trigger(jobID)
+	}
+
+	var job *gocron.Job
+	switch {
+	case schedule.Weekday != nil:
+		job = s.GoCron.Every(1).Weekday(*schedule.Weekday).At(schedule.At)
+	case schedule.At != "":
+		job = s.GoCron.Every(1).Day().At(schedule.At)
+	case schedule.Every > 0:
+		seconds := uint64(schedule.Every / time.Second)
+		if seconds == 0 {
+			seconds = 1
+		}
+		job = s.GoCron.Every(seconds).Seconds()
+	default:
+		// gocron has no cron expressions, the schedule is checked every second
+		job = s.GoCron.Every(1).Second()
+		s.nextRuns[jobID] = schedule.Next(time.Now())
+		run = func() {
+			if now := time.Now(); !now.Before(s.nextRuns[jobID]) {
+				s.nextRuns[jobID] = schedule.Next(now)
+				go s.trigger(jobID)
+			}
+		}
+	}
+	job.Do(run)
+
+	s.Jobs[detail.JobID] = job
+	s.Details[detail.JobID] = detail
 
+	return nil
 }
 
-// Update gocron job
-func (s *SchedulerGoCron) Update(args ...interface{}) {
+// Update gocron job. Job is removed if its schedule is cleared.
+func (s *SchedulerGoCron) Update(detail *model2.JobDetail) error {
+	if detail.Schedule.String == "" {
+		s.Delete(detail.JobID)
+		return nil
+	}
 
+	return s.Add(detail)
 }
 
 // Delete gocron job
-func (s *SchedulerGoCron) Delete(args ...interface{}) {
+func (s *SchedulerGoCron) Delete(jobID int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
+	s.remove(jobID)
 }
 
-// Run gocron job
-func (s *SchedulerGoCron) Run() {
+// Run gocron job immediately
+func (s *SchedulerGoCron) Run(jobID int64) error {
+	s.mutex.Lock()
+	_, ok := s.Details[jobID]
+	s.mutex.Unlock()
+
+	if !ok {
+		return errors.New("job is not scheduled")
+	}
+
+	go s.trigger(jobID)
 
+	return nil
 }
 
-// Stop gocron job
+// Every run gocron system task in every interval. Already scheduled task
+// is replaced.
+func (s *SchedulerGoCron) Every(name string, interval time.Duration, task func()) error {
+	seconds := uint64(interval / time.Second)
+	if seconds == 0 {
+		return errTaskInterval
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if job, ok := s.Tasks[name]; ok {
+		s.GoCron.RemoveByRef(job)
+	}
+
+	job := s.GoCron.Every(seconds).Seconds()
+	job.Do(func() {
+		go task()
+	})
+	s.Tasks[name] = job
+
+	return nil
+}
+
+// Stop gocron ticker
 func (s *SchedulerGoCron) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
+	if s.stopped != nil {
+		s.stopped <- true
+		s.stopped = nil
+	}
 }
 
 // Down gocron kill
 func (s *SchedulerGoCron) Down() {
+	s.Stop()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	s.GoCron.Clear()
 	s.GoCron = nil
+	s.Jobs = nil
+	s.Details = nil
+	s.Tasks = nil
+	s.nextRuns = nil
+}
+
+func (s *SchedulerGoCron) remove(jobID int64) {
+	if job, ok := s.Jobs[jobID]; ok {
+		s.GoCron.RemoveByRef(job)
+		delete(s.Jobs, jobID)
+		delete(s.Details, jobID)
+		delete(s.nextRuns, jobID)
+	}
+}
+
+func (s *SchedulerGoCron) trigger(jobID int64) {
+	s.mutex.Lock()
+	detail, ok := s.Details[jobID]
+	s.mutex.Unlock()
+
+	if ok {
+		s.Scheduler.Trigger(detail)
+	}
 }
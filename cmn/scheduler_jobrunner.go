@@ -16,55 +16,185 @@
 
 package cmn
 
-import "github.com/bamzi/jobrunner"
+import (
+	"errors"
+	"github.com/bamzi/jobrunner"
+	"github.com/robfig/cron/v3"
+	model2 "github.com/streetbyters/agente/database/model"
+	"sort"
+	"sync"
+	"time"
+)
 
 // SchedulerJobRunner jobrunner package adapter
 type SchedulerJobRunner struct {
 	SchedulerInterface `json:"-"`
 	*Scheduler
+	Entries map[int64]cron.EntryID
+	Details map[int64]*model2.JobDetail
+	Tasks   map[string]cron.EntryID
+	mutex   sync.Mutex
 }
 
-// Up jobruner start
+// Up jobrunner start and register scheduled jobs
 func (s *SchedulerJobRunner) Up() {
 	jobrunner.Start()
+
+	s.mutex.Lock()
+	s.Entries = make(map[int64]cron.EntryID)
+	s.Details = make(map[int64]*model2.JobDetail)
+	s.Tasks = make(map[string]cron.EntryID)
+	s.mutex.Unlock()
+
+	details, err := s.Scheduler.Details()
+	if err != nil {
+		s.Scheduler.App.Logger.LogError(err, "scheduled jobs could not be loaded")
+		return
+	}
+
+	for _, d := range details {
+		if err := s.Add(d); err != nil {
+			s.Scheduler.App.Logger.LogError(err, "job could not be scheduled: "+d.Code)
+		}
+	}
 }
 
-// Start jobrunner job
+// Start jobrunner cron
 func (s *SchedulerJobRunner) Start() {
-
+	jobrunner.MainCron.Start()
 }
 
 // List jobrunner jobs
-func (s *SchedulerJobRunner) List() {
-
+func (s *SchedulerJobRunner) List() []*SchedulerJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var jobs []*SchedulerJob
+	for jobID, id := range s.Entries {
+		detail := s.Details[jobID]
+		jobs = append(jobs, &SchedulerJob{
+			JobID:    jobID,
+			Code:     detail.Code,
+			Schedule: detail.Schedule.String,
+			NextRun:  jobrunner.MainCron.Entry(id).Next,
+			Data:     detail,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].JobID < jobs[j].JobID
+	})
+
+	return jobs
 }
 
-// Add jobrunner job
-func (s *SchedulerJobRunner) Add(args ...interface{}) {
+// Add jobrunner job. Already scheduled job is replaced.
+func (s *SchedulerJobRunner) Add(detail *model2.JobDetail) error {
+	schedule, err := ParseSchedule(detail.Schedule.String)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.remove(detail.JobID)
+
+	jobID := detail.JobID
+	s.Entries[jobID] = jobrunner.MainCron.Schedule(schedule.Schedule, jobrunner.New(jobrunner.Func(func() {
+		s.trigger(jobID)
+	})))
+	s.Details[jobID] = detail
 
+	return nil
 }
 
-// Update jobrunner job
-func (s *SchedulerJobRunner) Update(args ...interface{}) {
+// Update jobrunner job. Job is removed if its schedule is cleared.
+func (s *SchedulerJobRunner) Update(detail *model2.JobDetail) error {
+	if detail.Schedule.String == "" {
+		s.Delete(detail.JobID)
+		return nil
+	}
 
+	return s.Add(detail)
 }
 
 // Delete jobrunner job
-func (s *SchedulerJobRunner) Delete(args ...interface{}) {
+func (s *SchedulerJobRunner) Delete(jobID int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
+	s.remove(jobID)
 }
 
-// Run jobrunner job
-func (s *SchedulerJobRunner) Run() {
+// Run jobrunner job immediately
+func (s *SchedulerJobRunner) Run(jobID int64) error {
+	s.mutex.Lock()
+	_, ok := s.Details[jobID]
+	s.mutex.Unlock()
 
+	if !ok {
+		return errors.New("job is not scheduled")
+	}
+
+	jobrunner.Now(jobrunner.Func(func() {
+		s.trigger(jobID)
+	}))
+
+	return nil
 }
 
-// Stop jobrunner job
-func (s *SchedulerJobRunner) Stop() {
+// Every run jobrunner system task in every interval. Already scheduled task
+// is replaced.
+func (s *SchedulerJobRunner) Every(name string, interval time.Duration, task func()) error {
+	if interval < time.Second {
+		return errTaskInterval
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if id, ok := s.Tasks[name]; ok {
+		jobrunner.Remove(id)
+	}
+	s.Tasks[name] = jobrunner.MainCron.Schedule(cron.Every(interval), jobrunner.New(jobrunner.Func(task)))
 
+	return nil
+}
+
+// Stop jobrunner cron
+func (s *SchedulerJobRunner) Stop() {
+	jobrunner.MainCron.Stop()
 }
 
 // Down jobrunner kill
 func (s *SchedulerJobRunner) Down() {
 	jobrunner.Stop()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, id := range s.Tasks {
+		jobrunner.Remove(id)
+	}
+	s.Entries = nil
+	s.Details = nil
+	s.Tasks = nil
+}
+
+func (s *SchedulerJobRunner) remove(jobID int64) {
+	if id, ok := s.Entries[jobID]; ok {
+		jobrunner.Remove(id)
+		delete(s.Entries, jobID)
+		delete(s.Details, jobID)
+	}
+}
+
+func (s *SchedulerJobRunner) trigger(jobID int64) {
+	s.mutex.Lock()
+	detail, ok := s.Details[jobID]
+	s.mutex.Unlock()
+
+	if ok {
+		s.Scheduler.Trigger(detail)
+	}
 }
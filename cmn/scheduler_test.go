@@ -0,0 +1,221 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/database/model"
+	"testing"
+	"time"
+)
+
+func newScheduleDetail(jobID int64, code string, schedule string) *model.JobDetail {
+	detail := model.NewJobDetail()
+	detail.JobID = jobID
+	detail.Code = code
+	detail.Schedule.SetValid(schedule)
+
+	return detail
+}
+
+func Test_ParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("@every 10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Every != 10*time.Minute {
+		t.Fatalf("unexpected interval: %s", schedule.Every)
+	}
+
+	schedule, err = ParseSchedule("@weekly")
+	if err != nil || schedule.Weekday == nil || *schedule.Weekday != time.Sunday {
+		t.Fatal("weekly schedule should run on sunday", err)
+	}
+
+	schedule, err = ParseSchedule("0 30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Every != 0 || schedule.At != "" {
+		t.Fatal("cron schedule should not have interval hints")
+	}
+	next := schedule.Next(time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local))
+	if !next.Equal(time.Date(2020, 1, 1, 2, 30, 0, 0, time.Local)) {
+		t.Fatalf("unexpected next run: %s", next)
+	}
+
+	for _, spec := range []string{"", "every 10m", "* * *", "@every abc", "@fortnightly"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("schedule should be invalid: %s", spec)
+		}
+	}
+}
+
+// schedulerScenarios scenarios run against every registered scheduler package
+var schedulerScenarios = map[string]func(t *testing.T, s SchedulerInterface){
+	"AddAndList": func(t *testing.T, s SchedulerInterface) {
+		if err := s.Add(newScheduleDetail(1, "backup", "@every 1h")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(newScheduleDetail(2, "report", "@daily")); err != nil {
+			t.Fatal(err)
+		}
+
+		jobs := s.List()
+		if len(jobs) != 2 || jobs[0].Code != "backup" || jobs[1].Code != "report" {
+			t.Fatalf("unexpected jobs: %v", jobs)
+		}
+		if next := jobs[0].NextRun; next.Before(time.Now().Add(59 * time.Minute)) {
+			t.Fatalf("unexpected next run: %s", next)
+		}
+	},
+	"AddCronSchedule": func(t *testing.T, s SchedulerInterface) {
+		if err := s.Add(newScheduleDetail(1, "cleanup", "*/5 * * * *")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(newScheduleDetail(2, "heartbeat", "*/10 * * * * *")); err != nil {
+			t.Fatal(err)
+		}
+
+		jobs := s.List()
+		if len(jobs) != 2 {
+			t.Fatalf("unexpected jobs: %v", jobs)
+		}
+		if next := jobs[0].NextRun; next.Minute()%5 != 0 || next.Second() != 0 || next.Before(time.Now()) {
+			t.Fatalf("unexpected next run: %s", next)
+		}
+		if next := jobs[1].NextRun; next.Second()%10 != 0 || next.After(time.Now().Add(10*time.Second)) {
+			t.Fatalf("unexpected next run: %s", next)
+		}
+	},
+	"NextRunOfSchedules": func(t *testing.T, s SchedulerInterface) {
+		specs := []string{"@hourly", "@daily", "@midnight", "@weekly", "@monthly", "@every 10m",
+			"*/5 * * * *", "0 30 2 * * *"}
+		for i, spec := range specs {
+			schedule, err := ParseSchedule(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := schedule.Next(time.Now())
+
+			if err := s.Add(newScheduleDetail(int64(i+1), "job", spec)); err != nil {
+				t.Fatal(err)
+			}
+			jobs := s.List()
+			if next := jobs[i].NextRun; next.Sub(expected) > 2*time.Second || expected.Sub(next) > 2*time.Second {
+				t.Fatalf("next run of %s should be %s: %s", spec, expected, next)
+			}
+		}
+	},
+	"AddInvalidSchedule": func(t *testing.T, s SchedulerInterface) {
+		for _, spec := range []string{"", "* * *", "@every abc"} {
+			if err := s.Add(newScheduleDetail(1, "invalid", spec)); err == nil {
+				t.Fatalf("invalid schedule should not be added: %s", spec)
+			}
+		}
+		if len(s.List()) != 0 {
+			t.Fatal("invalid schedule should not be listed")
+		}
+	},
+	"UpdateReplacesJob": func(t *testing.T, s SchedulerInterface) {
+		s.Add(newScheduleDetail(1, "backup", "@every 1h"))
+		if err := s.Update(newScheduleDetail(1, "backup_v2", "@every 1m")); err != nil {
+			t.Fatal(err)
+		}
+
+		jobs := s.List()
+		if len(jobs) != 1 || jobs[0].Code != "backup_v2" || jobs[0].Schedule != "@every 1m" {
+			t.Fatalf("updated job should replace scheduled job: %v", jobs)
+		}
+	},
+	"UpdateWithoutScheduleRemovesJob": func(t *testing.T, s SchedulerInterface) {
+		s.Add(newScheduleDetail(1, "backup", "@every 1h"))
+		if err := s.Update(newScheduleDetail(1, "backup", "")); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.List()) != 0 {
+			t.Fatal("job should be removed if its schedule is cleared")
+		}
+	},
+	"Delete": func(t *testing.T, s SchedulerInterface) {
+		s.Add(newScheduleDetail(1, "backup", "@every 1h"))
+		s.Add(newScheduleDetail(2, "report", "@every 2h"))
+		s.Delete(1)
+		s.Delete(3)
+
+		jobs := s.List()
+		if len(jobs) != 1 || jobs[0].JobID != 2 {
+			t.Fatalf("unexpected jobs: %v", jobs)
+		}
+	},
+	"Run": func(t *testing.T, s SchedulerInterface) {
+		if err := s.Run(1); err == nil {
+			t.Fatal("unscheduled job should not be run")
+		}
+
+		s.Add(newScheduleDetail(1, "backup", "@every 1h"))
+		if err := s.Run(1); err != nil {
+			t.Fatal(err)
+		}
+	},
+	"Every": func(t *testing.T, s SchedulerInterface) {
+		if err := s.Every("sweep", time.Millisecond, func() {}); err == nil {
+			t.Fatal("task interval shorter than a second should not be scheduled")
+		}
+
+		run := make(chan bool, 10)
+		s.Every("sweep", time.Hour, func() {})
+		if err := s.Every("sweep", time.Second, func() { run <- true }); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-run:
+		case <-time.After(3 * time.Second):
+			t.Fatal("task should be run in every interval")
+		}
+		if len(s.List()) != 0 {
+			t.Fatal("tasks should not be listed as jobs")
+		}
+	},
+	"StopAndStart": func(t *testing.T, s SchedulerInterface) {
+		s.Add(newScheduleDetail(1, "backup", "@every 1h"))
+		s.Stop()
+		s.Start()
+
+		if len(s.List()) != 1 {
+			t.Fatal("scheduled jobs should be kept after restart")
+		}
+	},
+}
+
+func Test_SchedulerPackages(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	names, _ := (&Scheduler{App: app}).Packages()
+	for _, name := range names {
+		for scenario, fn := range schedulerScenarios {
+			t.Run(name+"/"+scenario, func(t *testing.T) {
+				_, packages := (&Scheduler{App: app}).Packages()
+				s := packages[name]
+				s.Up()
+				s.Start()
+				defer s.Down()
+
+				fn(t, s)
+			})
+		}
+	}
+}
+
+func Test_NewSchedulerWithUndefinedPackage(t *testing.T) {
+	app, clean := newJobTestApp(t, 0)
+	defer clean()
+
+	app.Config.Scheduler = "Undefined"
+	defer func() {
+		if recover() == nil {
+			t.Fatal("undefined scheduler should panic")
+		}
+	}()
+
+	NewScheduler(app)
+}
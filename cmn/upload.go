@@ -0,0 +1,243 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"errors"
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultUploadExpire seconds an upload is kept until it is referenced if
+// upload expire is not configured
+const DefaultUploadExpire = 300
+
+// UploadSweepInterval interval of the stale upload sweeper
+var UploadSweepInterval = time.Minute
+
+// UploadSweep uploads and upload sessions removed by a sweep with the
+// number of their removed files and reclaimed bytes
+type UploadSweep struct {
+	Uploads  int   `json:"uploads"`
+	Sessions int   `json:"sessions"`
+	Files    int   `json:"files"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// UploadExpire duration an upload is kept until it is referenced
+func UploadExpire(app *App) time.Duration {
+	expire := app.Config.UploadExpire
+	if expire <= 0 {
+		expire = DefaultUploadExpire
+	}
+
+	return time.Duration(expire) * time.Second
+}
+
+// TrackUpload record the blob linked to path as a pending upload of this
+// node which expires unless a file or job references it
+func TrackUpload(app *App, blob *Blob, path string, userID int64) (*model2.Upload, error) {
+	if app.Database == nil || app.Node == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	upload := model2.NewUpload(app.Node.ID)
+	upload.Dir, upload.File = filepath.Split(filepath.Clean(path))
+	upload.Dir = filepath.Clean(upload.Dir)
+	upload.Checksum = blob.Checksum
+	upload.Size = blob.Size
+	upload.Mime.SetValid(blob.Mime)
+	upload.ExpiresAt = time.Now().UTC().Add(UploadExpire(app))
+	if userID > 0 {
+		upload.SourceUserID.SetValid(userID)
+	}
+
+	if err := app.Database.Insert(new(model2.Upload), upload, "id", "inserted_at", "updated_at"); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// PromoteUploads mark pending uploads of the path or with the checksum
+// referenced so that they are not removed by the sweeper
+func PromoteUploads(app *App, path string, checksum string) error {
+	if app.Database == nil {
+		return errors.New("database is not ready")
+	}
+
+	dir, file := filepath.Split(filepath.Clean(path))
+	_, err := app.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET state = $1, "+
+		"updated_at = (CURRENT_TIMESTAMP at time zone 'utc') "+
+		"WHERE state = $2 AND ((dir = $3 AND file = $4) OR checksum = $5)", new(model2.Upload).TableName()),
+		model.UploadPromoted,
+		model.UploadPending,
+		filepath.Clean(dir),
+		file,
+		checksum)
+
+	return err
+}
+
+// SweepUploads remove expired pending uploads and upload sessions of this
+// node. Uploads which are referenced by a file or job are promoted instead.
+// Blob of a removed upload is kept if another upload or file uses it.
+func SweepUploads(app *App, now time.Time) (*UploadSweep, error) {
+	if app.Database == nil || app.Node == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	upload := new(model2.Upload)
+	var uploads []model2.Upload
+	res := app.Database.QueryWithModel(fmt.Sprintf("SELECT * FROM %s "+
+		"WHERE node_id = $1 AND state = $2 AND expires_at < $3 ORDER BY id ASC", upload.TableName()),
+		&uploads,
+		app.Node.ID,
+		model.UploadPending,
+		now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	sweep := &UploadSweep{}
+	for i := range uploads {
+		u := &uploads[i]
+
+		referenced, err := uploadReferenced(app, u)
+		if err != nil {
+			return sweep, err
+		}
+		if referenced {
+			if err := PromoteUploads(app, u.Path(), u.Checksum); err != nil {
+				return sweep, err
+			}
+			continue
+		}
+
+		blob := BlobPath(app, u.Checksum)
+		blobInfo, blobErr := os.Stat(blob)
+		if checksum, _, err := FileChecksum(u.Path()); err == nil && checksum == u.Checksum {
+			if err := os.Remove(u.Path()); err == nil {
+				sweep.Files++
+			}
+		}
+
+		var shared int64
+		if err := app.Database.DB.Get(&shared, fmt.Sprintf("SELECT count(*) FROM %s "+
+			"WHERE checksum = $1 AND id != $2", upload.TableName()), u.Checksum, u.ID); err != nil {
+			return sweep, err
+		}
+		if shared == 0 && blobErr == nil {
+			if err := os.Remove(blob); err == nil {
+				sweep.Files++
+				sweep.Bytes += blobInfo.Size()
+			}
+		}
+
+		if _, err := app.Database.DB.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1",
+			upload.TableName()), u.ID); err != nil {
+			return sweep, err
+		}
+		sweep.Uploads++
+	}
+
+	if err := sweepUploadSessions(app, now, sweep); err != nil {
+		return sweep, err
+	}
+
+	if sweep.Uploads > 0 || sweep.Sessions > 0 {
+		app.Logger.LogInfo(fmt.Sprintf("Reclaimed stale uploads: %d uploads, %d sessions, %d files, %d bytes",
+			sweep.Uploads, sweep.Sessions, sweep.Files, sweep.Bytes))
+	}
+
+	return sweep, nil
+}
+
+// sweepUploadSessions remove expired upload sessions of this node with
+// their received content
+func sweepUploadSessions(app *App, now time.Time, sweep *UploadSweep) error {
+	session := new(model2.UploadSession)
+	var ids []int64
+	err := app.Database.DB.Select(&ids, fmt.Sprintf("DELETE FROM %s "+
+		"WHERE node_id = $1 AND expires_at < $2 RETURNING id", session.TableName()),
+		app.Node.ID,
+		now)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		unlock := lockUploadSession(id)
+		path := PartPath(app, id)
+		if info, err := os.Stat(path); err == nil {
+			if err := os.Remove(path); err == nil {
+				sweep.Files++
+				sweep.Bytes += info.Size()
+			}
+		}
+		unlock()
+		sweep.Sessions++
+	}
+
+	return nil
+}
+
+// ScheduleUploadSweeper run the stale upload sweeper of this node with the
+// scheduler
+func ScheduleUploadSweeper(app *App) error {
+	return app.Scheduler.Package.Every("upload_sweeper", UploadSweepInterval, func() {
+		if _, err := SweepUploads(app, time.Now().UTC()); err != nil {
+			app.Logger.LogError(err, "stale uploads could not be swept")
+		}
+	})
+}
+
+// uploadReferenced a file uses the path or blob of the upload or a job uses
+// the path of the upload as script file
+func uploadReferenced(app *App, upload *model2.Upload) (bool, error) {
+	var count int64
+	err := app.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s "+
+		"WHERE (dir = $1 AND file = $2) OR checksum = $3", new(model2.File).TableName()),
+		upload.Dir,
+		upload.File,
+		upload.Checksum)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	err = app.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s "+
+		"WHERE checksum = $1", new(model2.FileVersion).TableName()),
+		upload.Checksum)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	scriptFile := upload.Path()
+	if rel, err := filepath.Rel(app.Config.LibPath, upload.Path()); err == nil {
+		scriptFile = rel
+	}
+	err = app.Database.DB.Get(&count, fmt.Sprintf("SELECT count(*) FROM %s "+
+		"WHERE script_file IN ($1, $2)", new(model2.JobDetail).TableName()),
+		upload.Path(),
+		scriptFile)
+
+	return count > 0, err
+}
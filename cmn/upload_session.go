@@ -0,0 +1,252 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmn
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	model2 "github.com/streetbyters/agente/database/model"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UploadSessionExpire duration an incomplete upload session is kept after
+// its last received chunk
+var UploadSessionExpire = 24 * time.Hour
+
+var (
+	// ErrUploadOffset chunk offset is not the length of received content
+	ErrUploadOffset = errors.New("upload offset does not match")
+	// ErrUploadLength chunk exceeds the upload length
+	ErrUploadLength = errors.New("upload length is exceeded")
+	// ErrUploadSessionNotFound upload session is removed
+	ErrUploadSessionNotFound = errors.New("upload session does not exist")
+)
+
+// uploadSessionLock lock of an upload session with the number of its holders
+// and waiters
+type uploadSessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+// uploadSessionLocks locks of upload sessions in use. Lock is removed once
+// it is released by its last holder, so locks of finished, deleted and
+// swept sessions are not kept.
+var uploadSessionLocks = struct {
+	sync.Mutex
+	locks map[int64]*uploadSessionLock
+}{locks: make(map[int64]*uploadSessionLock)}
+
+// PartPath path of received content of the upload session
+func PartPath(app *App, sessionID int64) string {
+	return filepath.Join(app.Config.LibPath, "blobs", "parts", strconv.FormatInt(sessionID, 10))
+}
+
+// UploadOffset length of received content of the upload session
+func UploadOffset(app *App, session *model2.UploadSession) int64 {
+	if session.Completed() {
+		return session.Length
+	}
+
+	info, err := os.Stat(PartPath(app, session.ID))
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// WriteChunk append chunk at offset to received content of the upload
+// session and return the new offset. Offset must be the length of received
+// content so that lost chunks are sent again from the right offset.
+func WriteChunk(app *App, session *model2.UploadSession, offset int64, chunk io.Reader) (int64, error) {
+	unlock := lockUploadSession(session.ID)
+	defer unlock()
+
+	if err := reloadUploadSession(app, session); err != nil {
+		return 0, err
+	}
+	if session.Completed() {
+		if offset != session.Length {
+			return session.Length, ErrUploadOffset
+		}
+		return session.Length, nil
+	}
+
+	current := UploadOffset(app, session)
+	if offset != current {
+		return current, ErrUploadOffset
+	}
+
+	path := PartPath(app, session.ID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return current, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return current, err
+	}
+
+	n, err := io.Copy(f, io.LimitReader(chunk, session.Length-current+1))
+	if err == nil && current+n > session.Length {
+		err = ErrUploadLength
+	}
+	if err != nil {
+		f.Truncate(current)
+		f.Close()
+		return current, err
+	}
+	if err := f.Close(); err != nil {
+		return current, err
+	}
+
+	if app.Database != nil {
+		app.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET expires_at = $1, "+
+			"updated_at = (CURRENT_TIMESTAMP at time zone 'utc') WHERE id = $2", session.TableName()),
+			time.Now().UTC().Add(UploadSessionExpire),
+			session.ID)
+	}
+
+	return current + n, nil
+}
+
+// FinishUpload store received content of the completed upload session as a
+// blob, link it to the session path and track it as an upload. Content is
+// discarded if it does not have the checksum of the session. Upload of the
+// session is returned if it is already finished.
+func FinishUpload(app *App, session *model2.UploadSession) (*model2.Upload, error) {
+	if app.Database == nil {
+		return nil, errors.New("database is not ready")
+	}
+
+	unlock := lockUploadSession(session.ID)
+	defer unlock()
+
+	if err := reloadUploadSession(app, session); err != nil {
+		return nil, err
+	}
+	if session.Completed() {
+		upload := new(model2.Upload)
+		err := app.Database.DB.Get(upload, fmt.Sprintf("SELECT * FROM %s WHERE id = $1", upload.TableName()),
+			session.UploadID.Int64)
+		return upload, err
+	}
+
+	if UploadOffset(app, session) != session.Length {
+		return nil, errors.New("upload is not complete")
+	}
+
+	path := PartPath(app, session.ID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := storeBlob(app, f, session.File, session.Checksum.String)
+	f.Close()
+	if err == ErrChecksumMismatch {
+		os.Remove(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := LinkBlob(app, blob.Checksum, session.Path()); err != nil {
+		return nil, err
+	}
+
+	upload, err := TrackUpload(app, blob, session.Path(), session.SourceUserID.Int64)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = app.Database.DB.Exec(fmt.Sprintf("UPDATE %s SET upload_id = $1, checksum = $2, "+
+		"updated_at = (CURRENT_TIMESTAMP at time zone 'utc') WHERE id = $3", session.TableName()),
+		upload.ID,
+		blob.Checksum,
+		session.ID)
+	if err != nil {
+		return nil, err
+	}
+	session.UploadID.SetValid(upload.ID)
+	session.Checksum.SetValid(blob.Checksum)
+	os.Remove(path)
+
+	return upload, nil
+}
+
+// RemoveUploadSession remove the upload session with its received content
+func RemoveUploadSession(app *App, session *model2.UploadSession) error {
+	unlock := lockUploadSession(session.ID)
+	defer unlock()
+
+	if err := app.Database.Delete(session.TableName(), "id = $1", session.ID).Error; err != nil {
+		return err
+	}
+	os.Remove(PartPath(app, session.ID))
+
+	return nil
+}
+
+// reloadUploadSession load current state of the upload session, so a
+// session changed or removed while waiting for its lock is not written
+func reloadUploadSession(app *App, session *model2.UploadSession) error {
+	if app.Database == nil {
+		return nil
+	}
+
+	err := app.Database.DB.Get(session, fmt.Sprintf("SELECT * FROM %s WHERE id = $1", session.TableName()),
+		session.ID)
+	if err == sql.ErrNoRows {
+		return ErrUploadSessionNotFound
+	}
+
+	return err
+}
+
+// lockUploadSession lock the upload session and return its unlock function
+func lockUploadSession(sessionID int64) func() {
+	uploadSessionLocks.Lock()
+	lock, ok := uploadSessionLocks.locks[sessionID]
+	if !ok {
+		lock = new(uploadSessionLock)
+		uploadSessionLocks.locks[sessionID] = lock
+	}
+	lock.refs++
+	uploadSessionLocks.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		uploadSessionLocks.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(uploadSessionLocks.locks, sessionID)
+		}
+		uploadSessionLocks.Unlock()
+	}
+}
@@ -0,0 +1,88 @@
+package cmn
+
+import (
+	"bytes"
+	model2 "github.com/streetbyters/agente/database/model"
+	"github.com/streetbyters/agente/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_WriteChunk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agente")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app := &App{Config: &model.Config{LibPath: dir}, Logger: logger}
+
+	session := model2.NewUploadSession(1)
+	session.ID = 1
+	session.Length = 10
+
+	if PartPath(app, session.ID) != filepath.Join(dir, "blobs", "parts", "1") {
+		t.Fatalf("unexpected part path: %s", PartPath(app, session.ID))
+	}
+	if UploadOffset(app, session) != 0 {
+		t.Fatal("offset of new session should be zero")
+	}
+
+	offset, err := WriteChunk(app, session, 0, bytes.NewBufferString("agent"))
+	if err != nil || offset != 5 {
+		t.Fatalf("unexpected offset: %d %v", offset, err)
+	}
+
+	offset, err = WriteChunk(app, session, 0, bytes.NewBufferString("agent"))
+	if err != ErrUploadOffset || offset != 5 {
+		t.Fatalf("chunk at wrong offset should not be written: %d %v", offset, err)
+	}
+
+	offset, err = WriteChunk(app, session, 5, bytes.NewBufferString("e streetbyters"))
+	if err != ErrUploadLength || offset != 5 || UploadOffset(app, session) != 5 {
+		t.Fatalf("chunk exceeding length should not be written: %d %v", offset, err)
+	}
+
+	offset, err = WriteChunk(app, session, 5, bytes.NewBufferString("e 1.0"))
+	if err != nil || offset != 10 {
+		t.Fatalf("unexpected offset: %d %v", offset, err)
+	}
+
+	content, _ := ioutil.ReadFile(PartPath(app, session.ID))
+	if string(content) != "agente 1.0" {
+		t.Fatalf("unexpected content: %s", content)
+	}
+
+	session.UploadID.SetValid(1)
+	os.Remove(PartPath(app, session.ID))
+	if UploadOffset(app, session) != 10 {
+		t.Fatal("offset of completed session should be its length")
+	}
+}
+
+func Test_LockUploadSession(t *testing.T) {
+	var wg sync.WaitGroup
+	var holders int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := lockUploadSession(1)
+			if atomic.AddInt32(&holders, 1) != 1 {
+				t.Error("upload session should be locked by one holder")
+			}
+			atomic.AddInt32(&holders, -1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	uploadSessionLocks.Lock()
+	defer uploadSessionLocks.Unlock()
+	if len(uploadSessionLocks.locks) != 0 {
+		t.Fatalf("released upload session locks should be removed: %d", len(uploadSessionLocks.locks))
+	}
+}
@@ -0,0 +1,26 @@
+package cmn
+
+import (
+	"github.com/streetbyters/agente/model"
+	"testing"
+	"time"
+)
+
+func Test_UploadExpire(t *testing.T) {
+	app := &App{Config: &model.Config{}, Logger: logger}
+	if expire := UploadExpire(app); expire != DefaultUploadExpire*time.Second {
+		t.Fatalf("unexpected default upload expire: %s", expire)
+	}
+
+	app.Config.UploadExpire = 60
+	if expire := UploadExpire(app); expire != time.Minute {
+		t.Fatalf("unexpected upload expire: %s", expire)
+	}
+}
+
+func Test_SweepUploadsWithoutDatabase(t *testing.T) {
+	app := &App{Config: &model.Config{}, Logger: logger}
+	if _, err := SweepUploads(app, time.Now()); err == nil {
+		t.Fatal("uploads should not be swept without database")
+	}
+}
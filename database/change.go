@@ -17,6 +17,7 @@
 package database
 
 import (
+	"database/sql/driver"
 	"github.com/shopspring/decimal"
 	"gopkg.in/guregu/null.v3/zero"
 	"reflect"
@@ -152,7 +153,29 @@ func getChanges(args ...interface{}) ([]Change, []string, map[string]interface{}
 					val.Set(val2)
 				}
 				break
+			default:
+				if _, ok := val2.Interface().(driver.Valuer); ok &&
+					(typ == "insert" || !reflect.DeepEqual(val.Interface(), val2.Interface())) {
+					change.Key = field.Name
+					change.Name = field.Tag.Get("db")
+					changes = append(changes, change)
+					keys = append(keys, change.Name)
+					namedParams[change.Name] = val2.Interface()
+					val.Set(val2)
+				}
+				break
 			}
+		case reflect.Slice:
+			if _, ok := val2.Interface().(driver.Valuer); ok &&
+				(typ == "insert" || !reflect.DeepEqual(val.Interface(), val2.Interface())) {
+				change.Key = field.Name
+				change.Name = field.Tag.Get("db")
+				changes = append(changes, change)
+				keys = append(keys, change.Name)
+				namedParams[change.Name] = val2.Interface()
+				val.Set(val2)
+			}
+			break
 		case reflect.String:
 			if val.String() != val2.String() {
 				change.Key = field.Name
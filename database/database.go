@@ -17,6 +17,7 @@
 package database
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -519,6 +520,48 @@ func (d *Database) Transaction(cb func(tx *Tx) error) *Database {
 	return d.commit()
 }
 
+// Begin start a transaction on a copy of the database. Queries of the copy
+// run in the transaction until it is committed or rolled back, queries of
+// the database itself are not part of it.
+func (d *Database) Begin() (*Database, error) {
+	tx, err := d.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	db := *d
+	db.Tx = tx
+	db.Error = nil
+	db.QueryType = ""
+	return &db, nil
+}
+
+// Commit commit transaction started with Begin
+func (d *Database) Commit() error {
+	if d.Tx == nil {
+		return nil
+	}
+
+	err := d.Tx.Commit()
+	d.Tx = nil
+	return err
+}
+
+// Rollback roll back transaction started with Begin. Transaction already
+// rolled back by a failed query is not an error.
+func (d *Database) Rollback() error {
+	if d.Tx == nil {
+		return nil
+	}
+
+	err := d.Tx.Rollback()
+	d.Tx = nil
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
 // Select query builder by database type.
 func (t *Tx) Select(table string, whereClause string) Result {
 	result := Result{}
@@ -20,21 +20,25 @@ import (
 	"github.com/streetbyters/agente/database"
 	"github.com/streetbyters/agente/model"
 	"gopkg.in/guregu/null.v3/zero"
+	"path/filepath"
 	"time"
 )
 
 // File job scripts database structure
 type File struct {
 	database.DBInterface `json:"-"`
-	ID                   int64      `db:"id" json:"id"`
-	NodeID               int64      `db:"node_id" json:"node_id" foreign:"fk_ra_files_node_id"`
-	ParentID             zero.Int   `db:"parent_id" json:"parent_id" foreign:"fk_ra_files_parent_id"`
-	JobID                zero.Int   `db:"job_id" json:"job_id" foreign:"fk_ra_files_job_id"`
-	Dir                  string     `db:"dir" json:"dir" validate:"required"`
-	File                 string     `db:"file" json:"file" validate:"required"`
-	Type                 model.Node `db:"type" json:"type"`
-	InsertedAt           time.Time  `db:"inserted_at" json:"inserted_at"`
-	UpdatedAt            time.Time  `db:"updated_at" json:"updated_at"`
+	ID                   int64       `db:"id" json:"id"`
+	NodeID               int64       `db:"node_id" json:"node_id" foreign:"fk_ra_files_node_id"`
+	ParentID             zero.Int    `db:"parent_id" json:"parent_id" foreign:"fk_ra_files_parent_id"`
+	JobID                zero.Int    `db:"job_id" json:"job_id" foreign:"fk_ra_files_job_id"`
+	Dir                  string      `db:"dir" json:"dir" validate:"required"`
+	File                 string      `db:"file" json:"file" validate:"required"`
+	Type                 model.Node  `db:"type" json:"type"`
+	Checksum             zero.String `db:"checksum" json:"checksum"`
+	Size                 zero.Int    `db:"size" json:"size"`
+	Mime                 zero.String `db:"mime" json:"mime"`
+	InsertedAt           time.Time   `db:"inserted_at" json:"inserted_at"`
+	UpdatedAt            time.Time   `db:"updated_at" json:"updated_at"`
 }
 
 // NewFile generate file structure
@@ -42,6 +46,11 @@ func NewFile() *File {
 	return &File{Type: model.Worker}
 }
 
+// Path file path on disk
+func (d *File) Path() string {
+	return filepath.Join(d.Dir, d.File)
+}
+
 // TableName file structure database table name
 func (d *File) TableName() string {
 	return "ra_files"
@@ -55,9 +55,10 @@ func (d *FileLog) ToJSON() string {
 
 // FileLogData jsonb structure
 type FileLogData struct {
-	Dir  string     `json:"dir,omitempty"`
-	File string     `json:"file,omitempty"`
-	Type model.Node `json:"type,omitempty"`
+	Dir      string     `json:"dir,omitempty"`
+	File     string     `json:"file,omitempty"`
+	Type     model.Node `json:"type,omitempty"`
+	Checksum string     `json:"checksum,omitempty"`
 }
 
 // Value file log data driver.Valuer
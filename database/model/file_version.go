@@ -0,0 +1,83 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/streetbyters/agente/database"
+	"github.com/streetbyters/agente/model"
+	"gopkg.in/guregu/null.v3/zero"
+	"path/filepath"
+	"time"
+)
+
+// FileVersion previous state of a job file database structure. Content of
+// the version is kept as the blob with its checksum.
+type FileVersion struct {
+	database.DBInterface `json:"-"`
+	ID                   int64       `db:"id" json:"id"`
+	NodeID               int64       `db:"node_id" json:"node_id" foreign:"fk_ra_file_versions_node_id"`
+	FileID               int64       `db:"file_id" json:"file_id" foreign:"fk_ra_file_versions_file_id"`
+	SourceUserID         zero.Int    `db:"source_user_id" json:"source_user_id" foreign:"fk_ra_file_versions_source_user_id"`
+	Version              int64       `db:"version" json:"version" unique:"ra_file_versions_file_id_version_unique"`
+	Dir                  string      `db:"dir" json:"dir"`
+	File                 string      `db:"file" json:"file"`
+	Type                 model.Node  `db:"type" json:"type"`
+	Checksum             zero.String `db:"checksum" json:"checksum"`
+	Size                 zero.Int    `db:"size" json:"size"`
+	Mime                 zero.String `db:"mime" json:"mime"`
+	InsertedAt           time.Time   `db:"inserted_at" json:"inserted_at"`
+}
+
+// NewFileVersion generate version structure of the current state of file
+func NewFileVersion(file *File) *FileVersion {
+	return &FileVersion{
+		NodeID:   file.NodeID,
+		FileID:   file.ID,
+		Dir:      file.Dir,
+		File:     file.File,
+		Type:     file.Type,
+		Checksum: file.Checksum,
+		Size:     file.Size,
+		Mime:     file.Mime,
+	}
+}
+
+// Path file path of the version on disk
+func (d *FileVersion) Path() string {
+	return filepath.Join(d.Dir, d.File)
+}
+
+// TableName file version structure database table name
+func (d *FileVersion) TableName() string {
+	return "ra_file_versions"
+}
+
+// ToJSON file version structure to json string
+func (d *FileVersion) ToJSON() string {
+	return database.ToJSON(d)
+}
+
+// FileVersionDiff line diff of text content of two file versions. To is
+// null when the version is compared with the current file content.
+type FileVersionDiff struct {
+	FileID    int64  `json:"file_id"`
+	From      int64  `json:"from"`
+	To        *int64 `json:"to"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Diff      string `json:"diff"`
+}
@@ -31,7 +31,7 @@ type JobDetail struct {
 	JobID                int64    `db:"job_id" json:"job_id" foreign:"fk_ra_job_details_job_id" validate:"required"`
 	SourceUserID         zero.Int `db:"source_user_id" foreign:"fk_ra_job_details_source_user_id" json:"source_user_id"`
 
-	Code       string        `db:"code" json:"code" validate:"required,gte=3,lte=64"`
+	Code       string        `db:"code" json:"code" validate:"required,gte=3,lte=64,slug"`
 	Name       string        `db:"name" json:"name" validate:"required,gte=3,lte=200"`
 	Type       model.JobType `db:"type" json:"type"`
 	Detail     zero.String   `db:"detail" json:"detail"`
@@ -42,6 +42,8 @@ type JobDetail struct {
 
 	ScriptFile zero.String `db:"script_file" json:"script_file"`
 	Script     zero.String `db:"script" json:"script"`
+	Process    zero.String `db:"process" json:"process" validate:"omitempty,slug,lte=64"`
+	Schedule   zero.String `db:"schedule" json:"schedule" validate:"omitempty,cron,lte=128"`
 
 	InsertedAt time.Time `db:"inserted_at" json:"inserted_at"`
 }
@@ -51,6 +53,15 @@ func NewJobDetail() *JobDetail {
 	return &JobDetail{}
 }
 
+// ProcessName managed process and release name of job detail. Job code is
+// used if the process is not set.
+func (d JobDetail) ProcessName() string {
+	if d.Process.String != "" {
+		return d.Process.String
+	}
+	return d.Code
+}
+
 // TableName job detail database table name
 func (d JobDetail) TableName() string {
 	return "ra_job_details"
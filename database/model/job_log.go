@@ -0,0 +1,80 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/streetbyters/agente/database"
+	"github.com/streetbyters/agente/model"
+	"time"
+)
+
+// JobLog execution log for job database structure
+type JobLog struct {
+	database.DBInterface `json:"-"`
+	ID                   int64      `db:"id" json:"id"`
+	NodeID               int64      `db:"node_id" json:"node_id" foreign:"fk_ra_job_logs_node_id"`
+	JobID                int64      `db:"job_id" json:"job_id" foreign:"fk_ra_job_logs_job_id"`
+	Data                 JobLogData `db:"data" json:"data,omitempty"`
+	State                bool       `db:"state" json:"state"`
+	InsertedAt           time.Time  `db:"inserted_at" json:"inserted_at"`
+}
+
+// NewJobLog generate job log structure
+func NewJobLog(jobID int64) *JobLog {
+	return &JobLog{JobID: jobID}
+}
+
+// TableName job log structure database table name
+func (d *JobLog) TableName() string {
+	return "ra_job_logs"
+}
+
+// ToJSON job log structure to json string
+func (d *JobLog) ToJSON() string {
+	return database.ToJSON(d)
+}
+
+// JobLogData jsonb structure
+type JobLogData struct {
+	Code       string                 `json:"code,omitempty"`
+	Type       model.JobType          `json:"type,omitempty"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	ExitCode   int                    `json:"exit_code"`
+	Stdout     string                 `json:"stdout,omitempty"`
+	Stderr     string                 `json:"stderr,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Message    *model.ReceivedMessage `json:"message,omitempty"`
+}
+
+// Value job log data driver.Valuer
+func (a JobLogData) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan job log data sql.Scanner
+func (a *JobLogData) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &a)
+}
@@ -17,6 +17,9 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"github.com/streetbyters/agente/database"
 	"github.com/streetbyters/agente/model"
 	"gopkg.in/guregu/null.v3/zero"
@@ -26,18 +29,24 @@ import (
 // Node application type structure
 type Node struct {
 	database.DBInterface `json:"-"`
-	ID                   int64       `db:"id" json:"id"`
-	Name                 string      `db:"name" json:"name" validate:"required,gte=3,lte=200"`
-	Code                 string      `db:"code" json:"code" unique:"ra_nodes_code_unique_index" validate:"required,gte=3,lte=200"`
-	Detail               zero.String `db:"detail" json:"detail"`
-	Type                 model.Node  `db:"type" json:"type"`
-	InsertedAt           time.Time   `db:"inserted_at" json:"inserted_at"`
-	UpdatedAt            time.Time   `db:"updated_at" json:"updated_at"`
+	ID                   int64           `db:"id" json:"id"`
+	Name                 string          `db:"name" json:"name" validate:"required,gte=3,lte=200"`
+	Code                 string          `db:"code" json:"code" unique:"ra_nodes_code_unique_index" validate:"required,gte=3,lte=200"`
+	Detail               zero.String     `db:"detail" json:"detail"`
+	Type                 model.Node      `db:"type" json:"type" validate:"oneof=worker master"`
+	Version              zero.String     `db:"version" json:"version"`
+	Address              zero.String     `db:"address" json:"address"`
+	Capabilities         Strings         `db:"capabilities" json:"capabilities"`
+	Tags                 Strings         `db:"tags" json:"tags" validate:"dive,gte=1,lte=64"`
+	State                model.NodeState `db:"state" json:"state"`
+	LastSeenAt           zero.Time       `db:"last_seen_at" json:"last_seen_at"`
+	InsertedAt           time.Time       `db:"inserted_at" json:"inserted_at"`
+	UpdatedAt            time.Time       `db:"updated_at" json:"updated_at"`
 }
 
 // NewNode generate node structure
 func NewNode() *Node {
-	return &Node{Type: "worker"}
+	return &Node{Type: "worker", State: model.NodeOffline}
 }
 
 // TableName node database table name
@@ -49,3 +58,30 @@ func (d *Node) TableName() string {
 func (d *Node) ToJSON() string {
 	return database.ToJSON(d)
 }
+
+// Strings jsonb string list structure
+type Strings []string
+
+// Value string list driver.Valuer. Nil list is stored as null.
+func (a Strings) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(a)
+}
+
+// Scan string list sql.Scanner
+func (a *Strings) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &a)
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/streetbyters/agente/database"
+	"github.com/streetbyters/agente/model"
+	"gopkg.in/guregu/null.v3/zero"
+	"time"
+)
+
+// Rollout published job message database structure. Job results of the
+// nodes are collected as rollout results.
+type Rollout struct {
+	database.DBInterface `json:"-"`
+	ID                   int64          `db:"id" json:"id"`
+	NodeID               int64          `db:"node_id" json:"node_id" foreign:"fk_ra_rollouts_node_id"`
+	JobID                int64          `db:"job_id" json:"job_id" foreign:"fk_ra_rollouts_job_id"`
+	SourceUserID         zero.Int       `db:"source_user_id" json:"source_user_id" foreign:"fk_ra_rollouts_source_user_id"`
+	MessageID            string         `db:"message_id" json:"message_id" unique:"ra_rollouts_message_id_unique_index"`
+	JobName              string         `db:"job_name" json:"job_name"`
+	Targets              RolloutTargets `db:"targets" json:"targets"`
+	Expected             Strings        `db:"expected" json:"expected"`
+	ExpiresAt            zero.Time      `db:"expires_at" json:"expires_at"`
+	InsertedAt           time.Time      `db:"inserted_at" json:"inserted_at"`
+}
+
+// NewRollout generate rollout structure
+func NewRollout(jobID int64) *Rollout {
+	return &Rollout{JobID: jobID}
+}
+
+// TableName rollout database table name
+func (d *Rollout) TableName() string {
+	return "ra_rollouts"
+}
+
+// ToJSON rollout structure to json string
+func (d *Rollout) ToJSON() string {
+	return database.ToJSON(d)
+}
+
+// RolloutTargets jsonb structure
+type RolloutTargets model.MessageTargets
+
+// Value rollout targets driver.Valuer
+func (a RolloutTargets) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan rollout targets sql.Scanner
+func (a *RolloutTargets) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &a)
+}
+
+// RolloutSummary rollout with job results of the nodes. Expected nodes
+// which have not replied yet are listed as missing.
+type RolloutSummary struct {
+	*Rollout
+	Status    model.RolloutStatus `json:"status"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Missing   []string            `json:"missing"`
+	Results   []RolloutResult     `json:"results"`
+}
+
+// NewRolloutSummary generate rollout summary at the given time. Rollout is
+// failed if any node failed or an expected node has not replied until the
+// rollout expires. It is succeeded when every expected node succeeded and
+// pending otherwise. Rollouts without expected nodes expect the nodes which
+// replied.
+func NewRolloutSummary(rollout *Rollout, results []RolloutResult, now time.Time) *RolloutSummary {
+	summary := &RolloutSummary{
+		Rollout: rollout,
+		Status:  model.RolloutPending,
+		Missing: make([]string, 0),
+		Results: results,
+	}
+	if summary.Results == nil {
+		summary.Results = make([]RolloutResult, 0)
+	}
+
+	replied := make(map[string]bool)
+	for _, r := range results {
+		switch r.Status {
+		case model.RolloutSucceeded:
+			summary.Succeeded++
+		case model.RolloutFailed:
+			summary.Failed++
+		}
+		if r.Status != model.RolloutPending {
+			replied[r.Node] = true
+		}
+	}
+
+	for _, node := range rollout.Expected {
+		if !replied[node] {
+			summary.Missing = append(summary.Missing, node)
+		}
+	}
+
+	expired := rollout.ExpiresAt.Valid && !now.Before(rollout.ExpiresAt.Time)
+	if summary.Failed > 0 {
+		summary.Status = model.RolloutFailed
+	} else if len(summary.Missing) == 0 && summary.Succeeded > 0 && summary.Succeeded == len(results) {
+		summary.Status = model.RolloutSucceeded
+	} else if expired {
+		summary.Status = model.RolloutFailed
+	}
+
+	return summary
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/streetbyters/agente/database"
+	"github.com/streetbyters/agente/model"
+	"gopkg.in/guregu/null.v3/zero"
+	"time"
+)
+
+// RolloutResult job result of a node in a rollout database structure
+type RolloutResult struct {
+	database.DBInterface `json:"-"`
+	ID                   int64               `db:"id" json:"id"`
+	RolloutID            int64               `db:"rollout_id" json:"rollout_id" foreign:"fk_ra_rollout_results_rollout_id"`
+	Node                 string              `db:"node" json:"node" unique:"ra_rollout_results_rollout_id_node_unique_index"`
+	RunID                zero.Int            `db:"run_id" json:"run_id"`
+	Status               model.RolloutStatus `db:"status" json:"status"`
+	ExitCode             int                 `db:"exit_code" json:"exit_code"`
+	Duration             int64               `db:"duration" json:"duration"`
+	Digest               zero.String         `db:"digest" json:"digest"`
+	Error                zero.String         `db:"error" json:"error"`
+	InsertedAt           time.Time           `db:"inserted_at" json:"inserted_at"`
+	UpdatedAt            time.Time           `db:"updated_at" json:"updated_at"`
+}
+
+// NewRolloutResult generate rollout result structure
+func NewRolloutResult(rolloutID int64) *RolloutResult {
+	return &RolloutResult{RolloutID: rolloutID, Status: model.RolloutPending}
+}
+
+// TableName rollout result database table name
+func (d *RolloutResult) TableName() string {
+	return "ra_rollout_results"
+}
+
+// ToJSON rollout result structure to json string
+func (d *RolloutResult) ToJSON() string {
+	return database.ToJSON(d)
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/streetbyters/agente/database"
+	"github.com/streetbyters/agente/model"
+	"gopkg.in/guregu/null.v3/zero"
+	"path/filepath"
+	"time"
+)
+
+// Upload uploaded file waiting to be referenced database structure
+type Upload struct {
+	database.DBInterface `json:"-"`
+	ID                   int64             `db:"id" json:"id"`
+	NodeID               int64             `db:"node_id" json:"node_id" foreign:"fk_ra_uploads_node_id"`
+	SourceUserID         zero.Int          `db:"source_user_id" json:"source_user_id" foreign:"fk_ra_uploads_source_user_id"`
+	Dir                  string            `db:"dir" json:"dir"`
+	File                 string            `db:"file" json:"file"`
+	Checksum             string            `db:"checksum" json:"checksum"`
+	Size                 int64             `db:"size" json:"size"`
+	Mime                 zero.String       `db:"mime" json:"mime"`
+	State                model.UploadState `db:"state" json:"state"`
+	ExpiresAt            time.Time         `db:"expires_at" json:"expires_at"`
+	InsertedAt           time.Time         `db:"inserted_at" json:"inserted_at"`
+	UpdatedAt            time.Time         `db:"updated_at" json:"updated_at"`
+}
+
+// NewUpload generate pending upload structure
+func NewUpload(nodeID int64) *Upload {
+	return &Upload{NodeID: nodeID, State: model.UploadPending}
+}
+
+// Path uploaded file path
+func (d *Upload) Path() string {
+	return filepath.Join(d.Dir, d.File)
+}
+
+// TableName upload database table name
+func (d *Upload) TableName() string {
+	return "ra_uploads"
+}
+
+// ToJSON upload structure to json string
+func (d *Upload) ToJSON() string {
+	return database.ToJSON(d)
+}
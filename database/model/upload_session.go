@@ -0,0 +1,72 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"github.com/streetbyters/agente/database"
+	"gopkg.in/guregu/null.v3/zero"
+	"path/filepath"
+	"time"
+)
+
+// UploadSession resumable upload session database structure. Content is
+// written in parts until it reaches the upload length.
+type UploadSession struct {
+	database.DBInterface `json:"-"`
+	ID                   int64       `db:"id" json:"id"`
+	NodeID               int64       `db:"node_id" json:"node_id" foreign:"fk_ra_upload_sessions_node_id"`
+	SourceUserID         zero.Int    `db:"source_user_id" json:"source_user_id" foreign:"fk_ra_upload_sessions_source_user_id"`
+	UploadID             zero.Int    `db:"upload_id" json:"upload_id" foreign:"fk_ra_upload_sessions_upload_id"`
+	Dir                  string      `db:"dir" json:"dir"`
+	File                 string      `db:"file" json:"file"`
+	Length               int64       `db:"length" json:"length"`
+	Checksum             zero.String `db:"checksum" json:"checksum"`
+	ExpiresAt            time.Time   `db:"expires_at" json:"expires_at"`
+	InsertedAt           time.Time   `db:"inserted_at" json:"inserted_at"`
+	UpdatedAt            time.Time   `db:"updated_at" json:"updated_at"`
+}
+
+// NewUploadSession generate upload session structure
+func NewUploadSession(nodeID int64) *UploadSession {
+	return &UploadSession{NodeID: nodeID}
+}
+
+// Path uploaded file path
+func (d *UploadSession) Path() string {
+	return filepath.Join(d.Dir, d.File)
+}
+
+// Completed content of upload session is finalized
+func (d *UploadSession) Completed() bool {
+	return d.UploadID.Valid
+}
+
+// TableName upload session database table name
+func (d *UploadSession) TableName() string {
+	return "ra_upload_sessions"
+}
+
+// ToJSON upload session structure to json string
+func (d *UploadSession) ToJSON() string {
+	return database.ToJSON(d)
+}
+
+// UploadProgress upload session with the length of received content
+type UploadProgress struct {
+	*UploadSession
+	Offset int64 `json:"offset"`
+}
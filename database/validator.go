@@ -20,12 +20,33 @@ import (
 	"github.com/lib/pq"
 	"github.com/streetbyters/agente/utils"
 	"gopkg.in/go-playground/validator.v9"
+	"gopkg.in/guregu/null.v3/zero"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
 var validate = validator.New()
 
+// slug file name safe identifier, it can not start with a dot so that
+// it never resolves to the current or parent directory
+var slug = regexp.MustCompile(`^[A-Za-z0-9_@-][A-Za-z0-9_@.-]*$`)
+
+func init() {
+	validate.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(zero.String).String
+	}, zero.String{})
+
+	validate.RegisterValidation("cron", func(fl validator.FieldLevel) bool {
+		_, err := utils.ParseSchedule(fl.Field().String())
+		return err == nil
+	})
+
+	validate.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return slug.MatchString(fl.Field().String())
+	})
+}
+
 // Tag error constraint structure
 type Tag struct {
 	Name       string
@@ -84,6 +84,52 @@ func TestValidateStruct(t *testing.T) {
 	assert.Equal(t, errs["name"], "required")
 }
 
+type TestSchedule struct {
+	Schedule zero.String `validate:"omitempty,cron"`
+}
+
+func TestValidateStructWithCronSchedule(t *testing.T) {
+	for _, spec := range []string{"", "*/5 * * * *", "0 30 2 * * *", "@every 10m", "@daily"} {
+		testStruct := new(TestSchedule)
+		testStruct.Schedule.SetValid(spec)
+
+		_, err := ValidateStruct(testStruct)
+		assert.Nil(t, err, spec)
+	}
+
+	for _, spec := range []string{"every day", "* * *", "61 * * * *", "@every abc"} {
+		testStruct := new(TestSchedule)
+		testStruct.Schedule.SetValid(spec)
+
+		errs, err := ValidateStruct(testStruct)
+		assert.NotNil(t, err, spec)
+		assert.Equal(t, errs["schedule"], "cron")
+	}
+}
+
+type TestSlug struct {
+	Process zero.String `validate:"omitempty,slug"`
+}
+
+func TestValidateStructWithSlug(t *testing.T) {
+	for _, process := range []string{"", "app", "app_start", "app-1.2", "node@worker"} {
+		testStruct := new(TestSlug)
+		testStruct.Process.SetValid(process)
+
+		_, err := ValidateStruct(testStruct)
+		assert.Nil(t, err, process)
+	}
+
+	for _, process := range []string{".", "..", "../app", "app/../../etc", "/etc/passwd", ".hidden", "app name"} {
+		testStruct := new(TestSlug)
+		testStruct.Process.SetValid(process)
+
+		errs, err := ValidateStruct(testStruct)
+		assert.NotNil(t, err, process)
+		assert.Equal(t, errs["process"], "slug")
+	}
+}
+
 func TestValidateConstraint(t *testing.T) {
 	appPath = dirs[0]
 
@@ -18,32 +18,49 @@ package model
 
 // Config Application config structure
 type Config struct {
-	NodeType     Node   `json:"node_type"`
-	NodeName     string `json:"node_name"`
-	Path         string `json:"path"`
-	LibPath      string `json:"lib_path"`
-	Mode         MODE   `json:"mode"`
-	Port         int    `json:"port"`
-	SecretKey    string `json:"secret_key"`
-	DB           DB     `json:"db"`
-	DBPath       string `json:"db_path"`
-	DBName       string `json:"db_name"`
-	DBHost       string `json:"db_host"`
-	DBPort       int    `json:"db_port"`
-	DBUser       string `json:"db_user"`
-	DBPass       string `json:"db_pass"`
-	DBSsl        string `json:"db_ssl"`
-	RabbitMq     bool   `json:"-"`
-	RabbitMqHost string `json:"rabbitmq_host"`
-	RabbitMqPort int    `json:"rabbitmq_port"`
-	RabbitMqUser string `json:"rabbitmq_user"`
-	RabbitMqPass string `json:"rabbitmq_pass"`
-	Redis        bool   `json:"-"`
-	RedisHost    string `json:"redis_host"`
-	RedisPort    int    `json:"redis_port"`
-	RedisPass    string `json:"redis_pass"`
-	RedisDB      int    `json:"redis_db"`
-	ChannelName  string `json:"channel_name"`
-	Versioning   bool   `json:"versioning"`
-	Scheduler    string `json:"scheduler"`
+	NodeType              Node     `json:"node_type"`
+	NodeName              string   `json:"node_name"`
+	Tags                  []string `json:"tags"`
+	Address               string   `json:"address"`
+	HeartbeatInterval     int      `json:"heartbeat_interval"`
+	HeartbeatTimeout      int      `json:"heartbeat_timeout"`
+	Path                  string   `json:"path"`
+	LibPath               string   `json:"lib_path"`
+	UploadExpire          int      `json:"upload_expire"`
+	AllowedRoots          []string `json:"allowed_roots"`
+	Mode                  MODE     `json:"mode"`
+	Port                  int      `json:"port"`
+	SecretKey             string   `json:"secret_key"`
+	DB                    DB       `json:"db"`
+	DBPath                string   `json:"db_path"`
+	DBName                string   `json:"db_name"`
+	DBHost                string   `json:"db_host"`
+	DBPort                int      `json:"db_port"`
+	DBUser                string   `json:"db_user"`
+	DBPass                string   `json:"db_pass"`
+	DBSsl                 string   `json:"db_ssl"`
+	RabbitMq              bool     `json:"-"`
+	RabbitMqHost          string   `json:"rabbitmq_host"`
+	RabbitMqPort          int      `json:"rabbitmq_port"`
+	RabbitMqUser          string   `json:"rabbitmq_user"`
+	RabbitMqPass          string   `json:"rabbitmq_pass"`
+	RabbitMqPrefetch      int      `json:"rabbitmq_prefetch"`
+	RabbitMqDeliveryLimit int      `json:"rabbitmq_delivery_limit"`
+	Redis                 bool     `json:"-"`
+	RedisHost             string   `json:"redis_host"`
+	RedisPort             int      `json:"redis_port"`
+	RedisPass             string   `json:"redis_pass"`
+	RedisDB               int      `json:"redis_db"`
+	RedisStreamMaxLen     int      `json:"redis_stream_maxlen"`
+	Channel               Channel  `json:"channel"`
+	ChannelName           string   `json:"channel_name"`
+	ChannelSecret         string   `json:"-"`
+	MessageMaxAge         int      `json:"message_max_age"`
+	Versioning            bool     `json:"versioning"`
+	VersionKeep           int      `json:"versioning_keep"`
+	Scheduler             string   `json:"scheduler"`
+	JobShell              string   `json:"job_shell"`
+	JobTimeout            int      `json:"job_timeout"`
+	JobEnv                []string `json:"job_env"`
+	JobGrace              int      `json:"job_grace_period"`
 }
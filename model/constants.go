@@ -63,6 +63,26 @@ const (
 	Master Node = "master"
 )
 
+// NodeState liveness state of node
+type NodeState string
+
+const (
+	// NodeOnline node sends heartbeats
+	NodeOnline NodeState = "online"
+	// NodeOffline node missed heartbeats or stopped
+	NodeOffline NodeState = "offline"
+)
+
+// UploadState usage state of uploaded file
+type UploadState string
+
+const (
+	// UploadPending uploaded file is not referenced yet and deleted after expiry
+	UploadPending UploadState = "pending"
+	// UploadPromoted uploaded file is referenced by a file or job
+	UploadPromoted UploadState = "promoted"
+)
+
 // Process type for file operation
 type Process string
 
@@ -74,3 +94,41 @@ const (
 	// Distributing process for file operation
 	Distributing Process = "distributing"
 )
+
+// Channel queuing system type
+type Channel string
+
+const (
+	// RabbitMqChannel rabbitMQ queuing system
+	RabbitMqChannel Channel = "rabbitmq"
+	// RedisChannel redis pub/sub queuing system
+	RedisChannel Channel = "redis"
+	// RedisStreamChannel redis streams queuing system
+	RedisStreamChannel Channel = "redis_stream"
+	// MemoryChannel in-process queuing system
+	MemoryChannel Channel = "memory"
+)
+
+// ConnectionState queuing system connection state
+type ConnectionState string
+
+const (
+	// Connecting connection state
+	Connecting ConnectionState = "connecting"
+	// Connected connection state
+	Connected ConnectionState = "connected"
+	// Disconnected connection state
+	Disconnected ConnectionState = "disconnected"
+)
+
+// RolloutStatus job result status of a node in a rollout
+type RolloutStatus string
+
+const (
+	// RolloutPending no result is received yet
+	RolloutPending RolloutStatus = "pending"
+	// RolloutSucceeded job is finished successfully
+	RolloutSucceeded RolloutStatus = "succeeded"
+	// RolloutFailed job is failed
+	RolloutFailed RolloutStatus = "failed"
+)
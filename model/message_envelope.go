@@ -0,0 +1,120 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageClockSkew tolerated difference of node clocks for messages signed
+// in the future
+const MessageClockSkew = 5 * time.Minute
+
+// MessageEnvelope signed queuing message. Signature is the HMAC-SHA256 of
+// message identifier, timestamp, origin node and payload.
+type MessageEnvelope struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Origin    string `json:"origin"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// NewMessageEnvelope building signed envelope of the message sent by the
+// given origin node
+func NewMessageEnvelope(message *ReceivedMessage, origin string, key []byte, now time.Time) *MessageEnvelope {
+	envelope := &MessageEnvelope{
+		ID:        message.ID,
+		Timestamp: now.Unix(),
+		Origin:    origin,
+		Payload:   message.ToJSON(),
+	}
+	envelope.Signature = envelope.sign(key)
+
+	return envelope
+}
+
+// ParseMessageEnvelope parse envelope json string
+func ParseMessageEnvelope(str string) (*MessageEnvelope, error) {
+	envelope := &MessageEnvelope{}
+	if err := json.Unmarshal([]byte(str), envelope); err != nil {
+		return nil, errors.New("message is not a valid envelope")
+	}
+
+	return envelope, nil
+}
+
+// Open verify envelope signature and age and return its message. Messages
+// signed more than maxAge before now or more than MessageClockSkew after now
+// are rejected.
+func (e *MessageEnvelope) Open(key []byte, maxAge time.Duration, now time.Time) (*ReceivedMessage, error) {
+	if e.ID == "" {
+		return nil, errors.New("message has no identifier")
+	}
+
+	signature, err := hex.DecodeString(e.Signature)
+	if err != nil || !hmac.Equal(signature, e.mac(key)) {
+		return nil, errors.New("message signature is not valid")
+	}
+
+	age := now.Sub(time.Unix(e.Timestamp, 0))
+	if age > maxAge || age < -MessageClockSkew {
+		return nil, errors.New("message is expired")
+	}
+
+	message := NewReceivedMessage(e.Payload)
+	if message == nil {
+		return nil, errors.New("message payload is not valid")
+	}
+	if message.ID != e.ID {
+		return nil, errors.New("message identifier does not match")
+	}
+
+	return message, nil
+}
+
+// ToJSON envelope to json string
+func (e MessageEnvelope) ToJSON() string {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return ""
+	}
+	return string(body)
+}
+
+func (e *MessageEnvelope) sign(key []byte) string {
+	return hex.EncodeToString(e.mac(key))
+}
+
+func (e *MessageEnvelope) mac(key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(strings.Join([]string{
+		e.ID,
+		strconv.FormatInt(e.Timestamp, 10),
+		e.Origin,
+		e.Payload,
+	}, "\n")))
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_MessageEnvelope(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+	message := NewJobMessage("deploy", NewRelease)
+
+	envelope, err := ParseMessageEnvelope(NewMessageEnvelope(message, "node_master@host", key, now).ToJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := envelope.Open(key, time.Minute, now)
+	if err != nil || opened.ID != message.ID || opened.JobName != "deploy" {
+		t.Fatalf("unexpected message: %v %v", opened, err)
+	}
+	if envelope.Origin != "node_master@host" {
+		t.Fatalf("unexpected origin: %s", envelope.Origin)
+	}
+
+	if _, err := envelope.Open([]byte("other"), time.Minute, now); err == nil {
+		t.Fatal("message signed with another key should be rejected")
+	}
+	if _, err := envelope.Open(key, time.Minute, now.Add(2*time.Minute)); err == nil {
+		t.Fatal("expired message should be rejected")
+	}
+	if _, err := envelope.Open(key, time.Minute, now.Add(-2*time.Minute)); err != nil {
+		t.Fatalf("message signed within clock skew should be opened: %v", err)
+	}
+	if _, err := envelope.Open(key, time.Hour, now.Add(-MessageClockSkew-time.Minute)); err == nil {
+		t.Fatal("message signed in the future should be rejected")
+	}
+
+	envelope.Payload = NewJobMessage("shutdown", Shutdown).ToJSON()
+	if _, err := envelope.Open(key, time.Minute, now); err == nil {
+		t.Fatal("tampered message should be rejected")
+	}
+
+	unsigned, err := ParseMessageEnvelope(message.ToJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unsigned.Open(key, time.Minute, now); err == nil {
+		t.Fatal("unsigned message should be rejected")
+	}
+	if _, err := ParseMessageEnvelope("{"); err == nil {
+		t.Fatal("invalid envelope should not be parsed")
+	}
+}
@@ -18,12 +18,74 @@ package model
 
 import (
 	"encoding/json"
+	"github.com/google/uuid"
 )
 
 // ReceivedMessage queuing messasge payload
 type ReceivedMessage struct {
-	JobName string  `json:"job_name"`
-	Type    JobType `json:"type"`
+	MessageTargets
+	ID           string            `json:"id"`
+	JobName      string            `json:"job_name"`
+	Type         JobType           `json:"type"`
+	ReplyTo      string            `json:"reply_to,omitempty"`
+	Reply        *JobReply         `json:"reply,omitempty"`
+	Heartbeat    *NodeHeartbeat    `json:"heartbeat,omitempty"`
+	Distribution *FileDistribution `json:"distribution,omitempty"`
+}
+
+// JobReply job result of a node sent back to the node which published the
+// job message
+type JobReply struct {
+	MessageID string        `json:"message_id"`
+	Node      string        `json:"node"`
+	RunID     int64         `json:"run_id,omitempty"`
+	Status    RolloutStatus `json:"status"`
+	ExitCode  int           `json:"exit_code"`
+	Duration  int64         `json:"duration"`
+	Digest    string        `json:"digest,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// MessageTargets optional target node codes, node types and node tags of
+// queuing message. Message is sent to every node if there is no target.
+type MessageTargets struct {
+	Nodes     []string `json:"nodes,omitempty"`
+	NodeTypes []Node   `json:"node_types,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// Broadcast message has no target
+func (t MessageTargets) Broadcast() bool {
+	return len(t.Nodes) == 0 && len(t.NodeTypes) == 0 && len(t.Tags) == 0
+}
+
+// Targets message targets the node with given code, type or any of tags
+func (t MessageTargets) Targets(node string, typ Node, tags []string) bool {
+	if t.Broadcast() {
+		return true
+	}
+
+	for _, n := range t.Nodes {
+		if n == node {
+			return true
+		}
+	}
+
+	for _, nt := range t.NodeTypes {
+		if nt == typ {
+			return true
+		}
+	}
+
+	for _, tag := range t.Tags {
+		for _, nodeTag := range tags {
+			if tag == nodeTag {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 // NewReceivedMessage building queuing message
@@ -37,3 +99,85 @@ func NewReceivedMessage(str ...string) *ReceivedMessage {
 	}
 	return nil
 }
+
+// NewJobMessage building queuing message with a unique identifier for the
+// given job
+func NewJobMessage(jobName string, typ JobType) *ReceivedMessage {
+	return &ReceivedMessage{
+		ID:      uuid.New().String(),
+		JobName: jobName,
+		Type:    typ,
+	}
+}
+
+// NodeHeartbeat liveness message of a node sent to master nodes
+type NodeHeartbeat struct {
+	Node         string   `json:"node"`
+	Type         Node     `json:"type"`
+	Version      string   `json:"version"`
+	Address      string   `json:"address"`
+	Capabilities []string `json:"capabilities"`
+	Tags         []string `json:"tags,omitempty"`
+}
+
+// NewHeartbeatMessage building heartbeat message sent to master nodes
+func NewHeartbeatMessage(heartbeat *NodeHeartbeat) *ReceivedMessage {
+	return &ReceivedMessage{
+		MessageTargets: MessageTargets{NodeTypes: []Node{Master}},
+		ID:             uuid.New().String(),
+		Heartbeat:      heartbeat,
+	}
+}
+
+// FileDistribution file pushed by a master node. Target nodes fetch its
+// content from url with the token and verify it with the checksum.
+type FileDistribution struct {
+	FileID   int64  `json:"file_id"`
+	URL      string `json:"url"`
+	Token    string `json:"token,omitempty"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+}
+
+// NewDistributionMessage building file distribution message sent to the
+// target nodes or to every worker node if there is no target
+func NewDistributionMessage(distribution *FileDistribution, targets MessageTargets) *ReceivedMessage {
+	if targets.Broadcast() {
+		targets.NodeTypes = []Node{Worker}
+	}
+
+	return &ReceivedMessage{
+		MessageTargets: targets,
+		ID:             uuid.New().String(),
+		Distribution:   distribution,
+	}
+}
+
+// NewReplyMessage building reply message of the job message sent to the node
+// which published it
+func NewReplyMessage(message *ReceivedMessage, reply *JobReply) *ReceivedMessage {
+	reply.MessageID = message.ID
+
+	return &ReceivedMessage{
+		MessageTargets: MessageTargets{Nodes: []string{message.ReplyTo}},
+		ID:             uuid.New().String(),
+		JobName:        message.JobName,
+		Type:           message.Type,
+		Reply:          reply,
+	}
+}
+
+// ToJSON queuing message to json string
+func (m ReceivedMessage) ToJSON() string {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(body)
+}
+
+// TriggerResponse published job message with its rollout identifier
+type TriggerResponse struct {
+	*ReceivedMessage
+	RolloutID int64 `json:"rollout_id"`
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"testing"
+)
+
+func Test_MessageTargets(t *testing.T) {
+	targets := MessageTargets{}
+	if !targets.Broadcast() || !targets.Targets("node1", Worker, nil) {
+		t.Fatal("message without targets should be sent to every node")
+	}
+
+	targets = MessageTargets{Nodes: []string{"node1"}}
+	if !targets.Targets("node1", Master, nil) || targets.Targets("node2", Worker, nil) {
+		t.Fatal("message should only target given nodes")
+	}
+
+	targets = MessageTargets{NodeTypes: []Node{Master}, Tags: []string{"web", "eu"}}
+	if !targets.Targets("node1", Master, nil) {
+		t.Fatal("message should target given node type")
+	}
+	if !targets.Targets("node2", Worker, []string{"db", "eu"}) {
+		t.Fatal("message should target nodes with any of given tags")
+	}
+	if targets.Targets("node3", Worker, []string{"db"}) {
+		t.Fatal("message should not target other nodes")
+	}
+}
+
+func Test_NewReceivedMessageWithTargets(t *testing.T) {
+	message := NewJobMessage("deploy", NewRelease)
+	message.Tags = []string{"web"}
+
+	received := NewReceivedMessage(message.ToJSON())
+	if received == nil || received.ID != message.ID || received.JobName != "deploy" ||
+		len(received.Tags) != 1 || received.Tags[0] != "web" {
+		t.Fatalf("unexpected message: %v", received)
+	}
+
+	if NewReceivedMessage("{") != nil {
+		t.Fatal("invalid message should not be parsed")
+	}
+}
+
+func Test_NewReplyMessage(t *testing.T) {
+	message := NewJobMessage("deploy", NewRelease)
+	message.ReplyTo = "node_master@host"
+
+	reply := NewReplyMessage(message, &JobReply{Node: "node_worker@host", Status: RolloutSucceeded})
+	if reply.ID == "" || reply.ID == message.ID || reply.Reply.MessageID != message.ID {
+		t.Fatalf("unexpected reply identifiers: %v", reply)
+	}
+	if !reply.Targets("node_master@host", Master, nil) || reply.Targets("node_worker@host", Worker, nil) {
+		t.Fatal("reply should only target the node which published the message")
+	}
+
+	received := NewReceivedMessage(reply.ToJSON())
+	if received == nil || received.Reply == nil || received.Reply.Status != RolloutSucceeded {
+		t.Fatalf("unexpected message: %v", received)
+	}
+}
+
+func Test_NewDistributionMessage(t *testing.T) {
+	distribution := &FileDistribution{FileID: 1, URL: "http://master:4000/api/v1/file/1/content", Checksum: "abc"}
+
+	message := NewDistributionMessage(distribution, MessageTargets{})
+	if !message.Targets("node_worker@host", Worker, nil) || message.Targets("node_master@host", Master, nil) {
+		t.Fatal("distribution should target worker nodes if there is no target")
+	}
+
+	message = NewDistributionMessage(distribution, MessageTargets{Nodes: []string{"node_worker@host"}})
+	if !message.Targets("node_worker@host", Worker, nil) || message.Targets("node_worker2@host", Worker, nil) {
+		t.Fatal("distribution should only target given nodes")
+	}
+
+	received := NewReceivedMessage(message.ToJSON())
+	if received == nil || received.Distribution == nil || received.Distribution.FileID != 1 ||
+		received.Distribution.Checksum != "abc" {
+		t.Fatalf("unexpected message: %v", received)
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS ra_job_details DROP COLUMN IF EXISTS process;
@@ -0,0 +1 @@
+ALTER TABLE ra_job_details ADD COLUMN IF NOT EXISTS process varchar(64) null;
@@ -0,0 +1 @@
+ALTER TABLE ra_job_details ADD COLUMN IF NOT EXISTS schedule varchar(128) null;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ra_rollout_results CASCADE;
+DROP TABLE IF EXISTS ra_rollouts CASCADE;
+
+DROP TYPE IF EXISTS ra_rollout_status CASCADE;
@@ -0,0 +1,41 @@
+CREATE TYPE ra_rollout_status AS ENUM ('pending', 'succeeded', 'failed');
+
+CREATE TABLE IF NOT EXISTS ra_rollouts (
+    id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    node_id bigint not null,
+    job_id bigint not null,
+    source_user_id bigint null,
+    message_id varchar(64) not null,
+    job_name varchar(64) not null,
+    targets jsonb null,
+    inserted_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+
+    CONSTRAINT fk_ra_rollouts_node_id FOREIGN KEY (node_id)
+        REFERENCES ra_nodes(id) ON UPDATE CASCADE ON DELETE cascade,
+    CONSTRAINT fk_ra_rollouts_job_id FOREIGN KEY (job_id)
+        REFERENCES ra_jobs(id) ON UPDATE CASCADE ON DELETE cascade,
+    CONSTRAINT fk_ra_rollouts_source_user_id FOREIGN KEY (source_user_id)
+        REFERENCES ra_users(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ra_rollouts_message_id_unique_index ON ra_rollouts USING btree(message_id);
+CREATE INDEX IF NOT EXISTS ra_rollouts_job_id_index ON ra_rollouts USING btree(job_id);
+
+CREATE TABLE IF NOT EXISTS ra_rollout_results (
+    id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    rollout_id bigint not null,
+    node varchar(200) not null,
+    run_id bigint null,
+    status ra_rollout_status default 'pending',
+    exit_code int default 0,
+    duration bigint default 0,
+    digest varchar(64) null,
+    error text null,
+    inserted_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+
+    CONSTRAINT fk_ra_rollout_results_rollout_id FOREIGN KEY (rollout_id)
+        REFERENCES ra_rollouts(id) ON UPDATE CASCADE ON DELETE cascade
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ra_rollout_results_rollout_id_node_unique_index ON ra_rollout_results USING btree(rollout_id, node);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS ra_nodes_state_index;
+
+ALTER TABLE IF EXISTS ra_nodes DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE IF EXISTS ra_nodes DROP COLUMN IF EXISTS state;
+ALTER TABLE IF EXISTS ra_nodes DROP COLUMN IF EXISTS capabilities;
+ALTER TABLE IF EXISTS ra_nodes DROP COLUMN IF EXISTS address;
+ALTER TABLE IF EXISTS ra_nodes DROP COLUMN IF EXISTS version;
+
+DROP TYPE IF EXISTS ra_node_state CASCADE;
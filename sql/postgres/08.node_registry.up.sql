@@ -0,0 +1,9 @@
+CREATE TYPE ra_node_state AS ENUM ('online', 'offline');
+
+ALTER TABLE ra_nodes ADD COLUMN IF NOT EXISTS version varchar(64) null;
+ALTER TABLE ra_nodes ADD COLUMN IF NOT EXISTS address varchar(200) null;
+ALTER TABLE ra_nodes ADD COLUMN IF NOT EXISTS capabilities jsonb null;
+ALTER TABLE ra_nodes ADD COLUMN IF NOT EXISTS state ra_node_state default 'offline';
+ALTER TABLE ra_nodes ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITHOUT TIME ZONE null;
+
+CREATE INDEX IF NOT EXISTS ra_nodes_state_index ON ra_nodes USING btree(state);
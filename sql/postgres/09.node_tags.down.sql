@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS ra_nodes DROP COLUMN IF EXISTS tags;
@@ -0,0 +1 @@
+ALTER TABLE ra_nodes ADD COLUMN IF NOT EXISTS tags jsonb null;
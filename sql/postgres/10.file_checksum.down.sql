@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ra_files_parent_id_index;
+
+ALTER TABLE IF EXISTS ra_files DROP COLUMN IF EXISTS checksum;
@@ -0,0 +1,3 @@
+ALTER TABLE ra_files ADD COLUMN IF NOT EXISTS checksum varchar(64) null;
+
+CREATE INDEX IF NOT EXISTS ra_files_parent_id_index ON ra_files USING btree(parent_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ra_files_checksum_index;
+
+ALTER TABLE IF EXISTS ra_files DROP COLUMN IF EXISTS mime;
+ALTER TABLE IF EXISTS ra_files DROP COLUMN IF EXISTS size;
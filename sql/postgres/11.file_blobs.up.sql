@@ -0,0 +1,4 @@
+ALTER TABLE ra_files ADD COLUMN IF NOT EXISTS size bigint null;
+ALTER TABLE ra_files ADD COLUMN IF NOT EXISTS mime varchar(200) null;
+
+CREATE INDEX IF NOT EXISTS ra_files_checksum_index ON ra_files USING btree(checksum);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ra_uploads CASCADE;
+
+DROP TYPE IF EXISTS ra_upload_state CASCADE;
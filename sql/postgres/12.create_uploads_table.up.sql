@@ -0,0 +1,24 @@
+CREATE TYPE ra_upload_state AS ENUM ('pending', 'promoted');
+
+CREATE TABLE IF NOT EXISTS ra_uploads (
+    id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    node_id bigint not null,
+    source_user_id bigint null,
+    dir varchar(200) not null,
+    file varchar(200) not null,
+    checksum varchar(64) not null,
+    size bigint default 0,
+    mime varchar(200) null,
+    state ra_upload_state default 'pending',
+    expires_at TIMESTAMP WITHOUT TIME ZONE not null,
+    inserted_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+
+    CONSTRAINT fk_ra_uploads_node_id FOREIGN KEY (node_id)
+        REFERENCES ra_nodes(id) ON UPDATE CASCADE ON DELETE cascade,
+    CONSTRAINT fk_ra_uploads_source_user_id FOREIGN KEY (source_user_id)
+        REFERENCES ra_users(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS ra_uploads_state_expires_at_index ON ra_uploads USING btree(state, expires_at);
+CREATE INDEX IF NOT EXISTS ra_uploads_checksum_index ON ra_uploads USING btree(checksum);
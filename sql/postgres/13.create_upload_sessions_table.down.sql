@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ra_upload_sessions CASCADE;
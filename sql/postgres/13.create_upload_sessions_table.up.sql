@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS ra_upload_sessions (
+    id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    node_id bigint not null,
+    source_user_id bigint null,
+    upload_id bigint null,
+    dir varchar(200) not null,
+    file varchar(200) not null,
+    length bigint not null,
+    checksum varchar(64) null,
+    expires_at TIMESTAMP WITHOUT TIME ZONE not null,
+    inserted_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+
+    CONSTRAINT fk_ra_upload_sessions_node_id FOREIGN KEY (node_id)
+        REFERENCES ra_nodes(id) ON UPDATE CASCADE ON DELETE cascade,
+    CONSTRAINT fk_ra_upload_sessions_source_user_id FOREIGN KEY (source_user_id)
+        REFERENCES ra_users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT fk_ra_upload_sessions_upload_id FOREIGN KEY (upload_id)
+        REFERENCES ra_uploads(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS ra_upload_sessions_expires_at_index ON ra_upload_sessions USING btree(expires_at);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ra_file_versions CASCADE;
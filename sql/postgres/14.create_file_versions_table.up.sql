@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS ra_file_versions (
+    id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    node_id bigint not null,
+    file_id bigint not null,
+    source_user_id bigint null,
+    version bigint not null,
+    dir varchar(200) not null,
+    file varchar(200) not null,
+    type ra_node_type default 'worker',
+    checksum varchar(64) null,
+    size bigint null,
+    mime varchar(200) null,
+    inserted_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (CURRENT_TIMESTAMP at time zone 'utc'),
+
+    CONSTRAINT fk_ra_file_versions_node_id FOREIGN KEY (node_id)
+        REFERENCES ra_nodes(id) ON UPDATE CASCADE ON DELETE cascade,
+    CONSTRAINT fk_ra_file_versions_file_id FOREIGN KEY (file_id)
+        REFERENCES ra_files(id) ON UPDATE CASCADE ON DELETE cascade,
+    CONSTRAINT fk_ra_file_versions_source_user_id FOREIGN KEY (source_user_id)
+        REFERENCES ra_users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT ra_file_versions_file_id_version_unique UNIQUE (file_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS ra_file_versions_checksum_index ON ra_file_versions USING btree(checksum);
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS ra_rollouts DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE IF EXISTS ra_rollouts DROP COLUMN IF EXISTS expected;
@@ -0,0 +1,2 @@
+ALTER TABLE ra_rollouts ADD COLUMN IF NOT EXISTS expected jsonb null;
+ALTER TABLE ra_rollouts ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITHOUT TIME ZONE null;
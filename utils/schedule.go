@@ -0,0 +1,47 @@
+// Copyright 2019 StreetByters Community
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// ScheduleParser job schedule expression parser. Standard 5 field cron,
+// 6 field cron with seconds and descriptors (@daily, @every 10m) are
+// accepted.
+var ScheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour |
+	cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule parse job schedule expression
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	return ScheduleParser.Parse(spec)
+}
+
+// NextSchedules next n fire times of schedule after the given time
+func NextSchedules(schedule cron.Schedule, from time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		from = schedule.Next(from)
+		if from.IsZero() {
+			break
+		}
+		times = append(times, from)
+	}
+
+	return times
+}